@@ -0,0 +1,217 @@
+// chash-analyze compares how the consistent hashes of pkg/chash spread a
+// key sample over a cluster, and how many keys they move when the cluster
+// grows or shrinks.
+//
+//	chash-analyze -nodes 10 -keys keys.txt      (one key per line, - for stdin)
+//	chash-analyze -nodes 10 -random 1000000     (synthetic keys)
+//	chash-analyze -strategies ring,maglev -v    (per node loads as well)
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"dutil/pkg/chash"
+)
+
+// strategies builds every known consistent hash, empty.
+var strategies = map[string]func(o *options) (chash.CHash, error){
+	"ring": func(o *options) (chash.CHash, error) {
+		return chash.NewRing(chash.RingOptions{VirtualNodes: o.vnodes, Seed: o.seed}), nil
+	},
+	"jump": func(o *options) (chash.CHash, error) {
+		return chash.NewJumpCHash(o.seed), nil
+	},
+	"rendezvous": func(o *options) (chash.CHash, error) {
+		return chash.NewRendezvousCHash(o.seed), nil
+	},
+	"maglev": func(o *options) (chash.CHash, error) {
+		return chash.NewMaglevCHash(o.tableSize, o.seed)
+	},
+	"multiprobe": func(o *options) (chash.CHash, error) {
+		return chash.NewMultiProbeCHash(o.probes, o.seed), nil
+	},
+}
+
+type options struct {
+	nodes     int
+	change    int
+	seed      uint32
+	vnodes    int
+	tableSize uint64
+	probes    int
+	verbose   bool
+}
+
+func main() {
+	var o options
+	names := flag.String("strategies", "ring,jump,rendezvous,maglev,multiprobe", "comma separated hashes to compare")
+	keyFile := flag.String("keys", "", "file of keys, one per line, - for stdin")
+	random := flag.Int("random", 100000, "number of synthetic keys when no -keys are given")
+	flag.IntVar(&o.nodes, "nodes", 10, "cluster size")
+	flag.IntVar(&o.change, "change", 1, "nodes to add and remove for the moved keys")
+	seed := flag.Uint("seed", 0, "hash seed")
+	flag.IntVar(&o.vnodes, "vnodes", chash.DefaultVirtualNodes, "virtual nodes per ring node")
+	flag.Uint64Var(&o.tableSize, "table", chash.DefaultMaglevTableSize, "maglev table size, a prime")
+	flag.IntVar(&o.probes, "probes", chash.DefaultProbes, "multi-probe probes per key")
+	flag.BoolVar(&o.verbose, "v", false, "print the load of every node")
+	flag.Parse()
+	o.seed = uint32(*seed)
+
+	if err := run(&o, strings.Split(*names, ","), *keyFile, *random); err != nil {
+		fmt.Fprintf(os.Stderr, "chash-analyze: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(o *options, names []string, keyFile string, random int) error {
+	if o.nodes <= 0 || o.change < 0 || o.change >= o.nodes {
+		return errors.New("need -nodes > 0 and 0 <= -change < -nodes")
+	}
+	keys, err := loadKeys(keyFile, random)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d keys on %d nodes, changing %d of them moves at least %.2f%% on add, %.2f%% on remove\n\n",
+		len(keys), o.nodes, o.change,
+		100*float64(o.change)/float64(o.nodes+o.change), 100*float64(o.change)/float64(o.nodes))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "STRATEGY\tMEAN\tSTDDEV\tMAX/MEAN\tMOVED ON ADD\tMOVED ON REMOVE\t")
+	var loads []chash.Distribution
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		build, ok := strategies[name]
+		if !ok {
+			return fmt.Errorf("unknown strategy %q", name)
+		}
+
+		h, err := cluster(build, o, o.nodes)
+		if err != nil {
+			return err
+		}
+		d := chash.Analyze(h, keys)
+		loads = append(loads, d)
+
+		added, err := chash.Moved(h, keys, func(h chash.CHash) error {
+			for i := o.nodes; i < o.nodes+o.change; i++ {
+				if err := h.AddNode(nodeName(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Remove the last nodes added, which any strategy, jump hash
+		// included, supports.
+		h, err = cluster(build, o, o.nodes)
+		if err != nil {
+			return err
+		}
+		removed, err := chash.Moved(h, keys, func(h chash.CHash) error {
+			for i := o.nodes - 1; i >= o.nodes-o.change; i-- {
+				if err := h.RemoveNode(nodeName(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s\t%.1f\t%.1f\t%.3f\t%.2f%%\t%.2f%%\t\n",
+			name, d.Mean, d.StdDev, d.MaxMean(), 100*added, 100*removed)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if o.verbose {
+		fmt.Println()
+		printLoads(names, loads, o.nodes)
+	}
+	return nil
+}
+
+// cluster returns a hash of nodes nodes built by build.
+func cluster(build func(o *options) (chash.CHash, error), o *options, nodes int) (chash.CHash, error) {
+	h, err := build(o)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < nodes; i++ {
+		if err := h.AddNode(nodeName(i)); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func nodeName(i int) string { return "node-" + strconv.Itoa(i) }
+
+// loadKeys reads the keys from file, or makes up n of them without a file.
+func loadKeys(file string, n int) ([][]byte, error) {
+	var keys [][]byte
+	if file == "" {
+		for i := 0; i < n; i++ {
+			keys = append(keys, []byte("key-"+strconv.Itoa(i)))
+		}
+		return keys, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		keys = append(keys, append([]byte(nil), sc.Bytes()...))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys read")
+	}
+	return keys, nil
+}
+
+// printLoads prints a node per row and a strategy per column.
+func printLoads(names []string, loads []chash.Distribution, nodes int) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "NODE\t")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t", strings.ToUpper(strings.TrimSpace(name)))
+	}
+	fmt.Fprintln(w)
+
+	rows := make([]string, 0, nodes)
+	for i := 0; i < nodes; i++ {
+		rows = append(rows, nodeName(i))
+	}
+	sort.Strings(rows)
+	for _, node := range rows {
+		fmt.Fprintf(w, "%s\t", node)
+		for _, d := range loads {
+			fmt.Fprintf(w, "%d\t", d.Load[node])
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
@@ -0,0 +1,331 @@
+// dsynctl runs dsync lock servers and takes cluster wide locks from the
+// shell.
+//
+//	dsynctl server -addr :7001 [-peers host1:7001,host2:7001,host3:7001]
+//	dsynctl list   -servers host1:7001,host2:7001,host3:7001
+//	dsynctl lock   -servers ... -timeout 5s name -- cmd args
+//	dsynctl lock   -servers ... name              (prints the lock UID)
+//	dsynctl unlock -servers ... -uid UID name
+//	dsynctl force-unlock -servers ... name
+//
+// The server list may also come from the DSYNC_SERVERS environment variable.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"dutil/pkg/dsync"
+)
+
+const usage = `usage: dsynctl <command> [flags] [args]
+
+commands:
+  server        serve locks on -addr
+  list          list the locks held on every server
+  lock          acquire a write lock, run a command under it if given after --
+  unlock        release a lock taken by "lock" without a command
+  force-unlock  drop the locks on the given names, whoever holds them
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "server":
+		err = runServer(args)
+	case "list":
+		err = runList(args)
+	case "lock":
+		err = runLock(args)
+	case "unlock":
+		err = runUnlock(args)
+	case "force-unlock":
+		err = runForceUnlock(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var exitErr exitCode
+	if errors.As(err, &exitErr) {
+		os.Exit(int(exitErr))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dsynctl %s: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+// exitCode carries the exit status of a command run under a lock.
+type exitCode int
+
+func (e exitCode) Error() string { return "exit status " + strconv.Itoa(int(e)) }
+
+// clusterFlags are the flags shared by all client commands.
+type clusterFlags struct {
+	servers string
+	path    string
+}
+
+func (c *clusterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.servers, "servers", os.Getenv("DSYNC_SERVERS"), "comma separated lock servers, host:port")
+	fs.StringVar(&c.path, "path", "/dsync", "rpc path the lock servers serve on")
+}
+
+func (c *clusterFlags) clients() ([]*dsync.RPCClient, error) {
+	var clnts []*dsync.RPCClient
+	for _, addr := range strings.Split(c.servers, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			clnts = append(clnts, dsync.NewRPCClient(addr, c.path))
+		}
+	}
+	if len(clnts) == 0 {
+		return nil, errors.New("no lock servers given, use -servers or DSYNC_SERVERS")
+	}
+	return clnts, nil
+}
+
+func lockers(clnts []*dsync.RPCClient) []dsync.NetLocker {
+	lockers := make([]dsync.NetLocker, len(clnts))
+	for i, c := range clnts {
+		lockers[i] = c
+	}
+	return lockers
+}
+
+func runServer(args []string) error {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	addr := fs.String("addr", ":7001", "listen address")
+	path := fs.String("path", "/dsync", "rpc path to serve on")
+	peers := fs.String("peers", "", "comma separated lock servers of the cluster, this one included, to sweep stale locks against")
+	validity := fs.Duration("validity", dsync.LockValidity, "check locks held longer than this against the peers")
+	fs.Parse(args)
+
+	ls := dsync.NewLockServer()
+	server := rpc.NewServer()
+	if err := server.RegisterName("Dsync", ls); err != nil {
+		return err
+	}
+	if *peers != "" {
+		cf := clusterFlags{servers: *peers, path: *path}
+		clnts, err := cf.clients()
+		if err != nil {
+			return err
+		}
+		ds := &dsync.Dsync{GetLockersFn: func() []dsync.NetLocker { return lockers(clnts) }}
+		go ls.RunSweeper(context.Background(), ds, *validity, *validity)
+	}
+	server.HandleHTTP(*path, *path+"-debug")
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "dsynctl: serving locks on %s%s\n", l.Addr(), *path)
+	return http.Serve(l, nil)
+}
+
+func runList(args []string) error {
+	var cf clusterFlags
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	cf.register(fs)
+	fs.Parse(args)
+
+	clnts, err := cf.clients()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tRESOURCE\tTYPE\tUID\tSINCE\tSOURCE")
+	for _, c := range clnts {
+		locks, err := c.Locks(dsync.LockArgs{Resources: fs.Args()})
+		if err != nil {
+			fmt.Fprintf(w, "%s\t<%v>\t\t\t\t\n", c, err)
+			continue
+		}
+		for _, l := range locks {
+			kind := "read"
+			if l.Writer {
+				kind = "write"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c, l.Resource, kind, l.UID,
+				l.Since.Format(time.RFC3339), l.Source)
+		}
+	}
+	return w.Flush()
+}
+
+func runLock(args []string) error {
+	var cf clusterFlags
+	fs := flag.NewFlagSet("lock", flag.ExitOnError)
+	cf.register(fs)
+	timeout := fs.Duration("timeout", dsync.DRWMutexAcquireTimeout, "give up acquiring the lock after this long")
+	fs.Parse(args)
+
+	names, command := fs.Args(), []string(nil)
+	for i, arg := range names {
+		if arg == "--" {
+			names, command = names[:i], names[i+1:]
+			break
+		}
+	}
+	if len(names) == 0 {
+		return errors.New("no lock name given")
+	}
+
+	clnts, err := cf.clients()
+	if err != nil {
+		return err
+	}
+	ds := &dsync.Dsync{GetLockersFn: func() []dsync.NetLocker { return lockers(clnts) }}
+
+	uid, err := newUID()
+	if err != nil {
+		return err
+	}
+	source, _ := os.Hostname()
+	source = fmt.Sprintf("dsynctl@%s[%d]", source, os.Getpid())
+
+	// While the command runs we refresh a lease, so the lock is dropped if we
+	// die. Without a command the lock outlives us and takes no lease.
+	opts := dsync.Options{Timeout: *timeout}
+	if len(command) > 0 {
+		opts.Lease = dsync.LockLease
+	}
+	dm := dsync.NewDRWMutex(ds, names...)
+	if !dm.GetLock(context.Background(), uid, source, opts) {
+		return fmt.Errorf("unable to lock %s within %s", strings.Join(names, ","), *timeout)
+	}
+
+	if len(command) == 0 {
+		// The lock outlives us, hand the UID to the script so it can unlock.
+		fmt.Println(uid)
+		return nil
+	}
+
+	// The command shares our terminal and gets its interrupts itself, other
+	// signals are passed on. Either way we wait for it to exit and release
+	// the lock, which would stay held on every server otherwise.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	defer dm.Unlock()
+
+	c := exec.Command(command[0], command[1:]...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				if sig != os.Interrupt {
+					c.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	err = c.Wait()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitCode(exitErr.ExitCode())
+	}
+	return err
+}
+
+// newUID returns a random lock UID. Locks are released and swept by their
+// UID, so two processes must never share one, wherever and whenever they
+// start.
+func newUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func runUnlock(args []string) error {
+	var cf clusterFlags
+	fs := flag.NewFlagSet("unlock", flag.ExitOnError)
+	cf.register(fs)
+	uid := fs.String("uid", "", "UID printed by the lock command")
+	fs.Parse(args)
+
+	if *uid == "" || fs.NArg() == 0 {
+		return errors.New("both -uid and a lock name are required")
+	}
+	clnts, err := cf.clients()
+	if err != nil {
+		return err
+	}
+
+	released := 0
+	for _, c := range clnts {
+		ok, err := c.Unlock(dsync.LockArgs{UID: *uid, Resources: fs.Args()})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dsynctl: %s: %v\n", c, err)
+		}
+		if ok {
+			released++
+		}
+	}
+	if released == 0 {
+		return fmt.Errorf("lock %s is not held by %s on any server", strings.Join(fs.Args(), ","), *uid)
+	}
+	return nil
+}
+
+func runForceUnlock(args []string) error {
+	var cf clusterFlags
+	fs := flag.NewFlagSet("force-unlock", flag.ExitOnError)
+	cf.register(fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("no lock name given")
+	}
+	clnts, err := cf.clients()
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, c := range clnts {
+		if _, err := c.ForceUnlock(dsync.LockArgs{Resources: fs.Args()}); err != nil {
+			fmt.Fprintf(os.Stderr, "dsynctl: %s: %v\n", c, err)
+			failed++
+		}
+	}
+	if failed == len(clnts) {
+		return errors.New("no server could be reached")
+	}
+	return nil
+}
@@ -9,8 +9,8 @@ require (
 	github.com/hashicorp/go-msgpack v1.1.5 // indirect
 	github.com/hashicorp/go-multierror v1.1.0 // indirect
 	github.com/hashicorp/go-sockaddr v1.0.2 // indirect
-	github.com/hashicorp/golang-lru v0.5.4 // indirect
-	github.com/hashicorp/memberlist v0.2.2 // indirect
+	github.com/hashicorp/golang-lru v0.5.4
+	github.com/hashicorp/memberlist v0.2.2
 	github.com/miekg/dns v1.1.31 // indirect
 	github.com/minio/sha256-simd v0.1.1 // indirect
 	github.com/opentracing/opentracing-go v1.1.0
@@ -0,0 +1,363 @@
+// Package balancer is a reverse proxy spreading requests over backends by
+// consistent hashing, so that requests of the same session, user or client
+// stick to the same backend:
+//
+//	b := balancer.New(balancer.Options{Key: balancer.CookieKey("session")})
+//	b.AddBackend("http://10.0.0.1:8080", 1)
+//	b.AddBackend("http://10.0.0.2:8080", 1)
+//	go b.Run(ctx)
+//	http.ListenAndServe(":80", b)
+package balancer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"dutil/pkg/chash"
+)
+
+const (
+	// DefaultHealthCheckInterval is the time between two health checks of
+	// every backend unless Options say otherwise.
+	DefaultHealthCheckInterval = 10 * time.Second
+	// DefaultHealthCheckTimeout bounds a health check request unless
+	// Options say otherwise.
+	DefaultHealthCheckTimeout = 2 * time.Second
+	// DefaultRetries is the number of further backends a request is
+	// tried on after its own one failed, unless Options say otherwise.
+	DefaultRetries = 2
+)
+
+var (
+	ErrNoBackends     = errors.New("no backend available")
+	ErrInvalidBackend = errors.New("backend url needs a scheme and host")
+)
+
+// Options configures a Balancer.
+type Options struct {
+	// Key is the key requests are routed by, ClientIPKey when nil.
+	Key KeyFunc
+
+	// Ring configures the consistent hash ring of the backends. Its
+	// LoadFactor bounds the requests in flight on a backend to 1+LoadFactor
+	// times its share, 0 leaves them unbounded.
+	Ring chash.RingOptions
+
+	// HealthCheckPath is requested from every backend by Run, a backend
+	// answering with an error or a status of 500 and up is taken out of
+	// the ring until it answers again. "/" when empty.
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+
+	// Retries is the number of next backends on the ring a request is
+	// tried on when its backend cannot be reached, negative for none.
+	// Only requests without a body are retried.
+	Retries int
+
+	// Transport forwards the requests, http.DefaultTransport when nil.
+	Transport http.RoundTripper
+
+	// ErrorLog logs failed requests, the standard logger when nil.
+	ErrorLog *log.Logger
+}
+
+// Balancer is an http.Handler forwarding requests to the backend owning
+// their key on a consistent hash ring. When that backend cannot be
+// reached the request fails over to the next backends on the ring, and the
+// backend is taken out of the ring until a health check finds it up again.
+//
+// A Balancer is safe for concurrent use.
+type Balancer struct {
+	opts Options
+	ring *chash.Ring
+
+	mu       sync.RWMutex
+	backends map[string]*backend
+}
+
+var _ http.Handler = (*Balancer)(nil)
+
+type backend struct {
+	url   *url.URL
+	proxy *httputil.ReverseProxy
+}
+
+// New returns a Balancer without backends.
+func New(opts Options) *Balancer {
+	if opts.Key == nil {
+		opts.Key = ClientIPKey()
+	}
+	if opts.HealthCheckPath == "" {
+		opts.HealthCheckPath = "/"
+	}
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	if opts.HealthCheckTimeout <= 0 {
+		opts.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+	if opts.Retries == 0 {
+		opts.Retries = DefaultRetries
+	}
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+	return &Balancer{
+		opts:     opts,
+		ring:     chash.NewRing(opts.Ring),
+		backends: make(map[string]*backend),
+	}
+}
+
+// Ring returns the ring of the backends, to drain one of them for example:
+//
+//	b.Ring().SetState("http://10.0.0.1:8080", chash.NodeDraining)
+func (b *Balancer) Ring() *chash.Ring { return b.ring }
+
+// AddBackend adds the backend at rawurl, taking weight times the requests
+// of a backend of weight 1. Requests are forwarded to the path of rawurl
+// joined with their own path.
+func (b *Balancer) AddBackend(rawurl string, weight int) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return ErrInvalidBackend
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.Transport = b.opts.Transport
+	proxy.ErrorLog = b.opts.ErrorLog
+	proxy.ErrorHandler = b.proxyError
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.ring.Add(chash.Node{Name: rawurl, Addr: u.Host, Weight: weight}); err != nil {
+		return err
+	}
+	b.backends[rawurl] = &backend{url: u, proxy: proxy}
+	return nil
+}
+
+// RemoveBackend removes the backend added as rawurl.
+func (b *Balancer) RemoveBackend(rawurl string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.ring.RemoveNode(rawurl); err != nil {
+		return err
+	}
+	delete(b.backends, rawurl)
+	return nil
+}
+
+func (b *Balancer) backend(name string) *backend {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.backends[name]
+}
+
+// attemptKey is the context key of the *attempt of a forwarded request.
+type attemptKey struct{}
+
+// attempt collects the outcome of forwarding a request to one backend.
+type attempt struct {
+	last bool // write the error response when failing
+	err  error
+}
+
+// proxyError is the ErrorHandler of the backend proxies. It holds back the
+// error response unless no other backend is left to try.
+func (b *Balancer) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	a := r.Context().Value(attemptKey{}).(*attempt)
+	a.err = err
+	if a.last {
+		b.logf("balancer: %s %s: %v", r.Method, r.URL, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := b.opts.Key(r)
+	if len(key) == 0 {
+		key = clientIP(r)
+	}
+
+	attempts := 1
+	if b.opts.Retries > 0 {
+		attempts += b.opts.Retries
+	}
+	// A body cannot be sent twice.
+	if r.Body != nil && r.Body != http.NoBody {
+		attempts = 1
+	}
+
+	var tried []string
+	var err error
+	for i := 0; i < attempts; i++ {
+		name, release := b.pick(key, tried)
+		if name == "" {
+			break
+		}
+		tried = append(tried, name)
+		be := b.backend(name)
+		if be == nil {
+			release()
+			continue // removed meanwhile
+		}
+		a := &attempt{last: i == attempts-1}
+		be.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), attemptKey{}, a)))
+		release()
+		if err = a.err; err == nil {
+			return
+		}
+		if r.Context().Err() != nil {
+			return // the client went away, not the backend
+		}
+		b.logf("balancer: backend %s failed, taking it out: %v", name, a.err)
+		b.ring.SetState(name, chash.NodeDown)
+		if a.last {
+			return
+		}
+	}
+	if err != nil {
+		// No backend is left after the one that failed last.
+		b.logf("balancer: %s %s: %v", r.Method, r.URL, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	http.Error(w, ErrNoBackends.Error(), http.StatusServiceUnavailable)
+}
+
+// pick returns the next backend to try for key, passing over those tried
+// already, and a func to call once the attempt is done. It returns an
+// empty name when no backend is left.
+//
+// With bounded loads every backend tried is Acquired, so that requests
+// failing over count against the load of the backend serving them.
+func (b *Balancer) pick(key []byte, tried []string) (string, func()) {
+	if b.opts.Ring.LoadFactor <= 0 {
+		for _, name := range b.ring.GetNodes(key, len(tried)+1) {
+			if !contains(tried, name) {
+				return name, func() {}
+			}
+		}
+		return "", func() {}
+	}
+
+	// The backends that failed are down, Acquire walks the ring past them.
+	name, err := b.ring.Acquire(key)
+	if err != nil {
+		return "", func() {}
+	}
+	if contains(tried, name) {
+		// Back up meanwhile, it failed this request already.
+		b.ring.Release(name)
+		return "", func() {}
+	}
+	return name, func() { b.ring.Release(name) }
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Run health checks the backends every HealthCheckInterval until ctx is
+// done.
+func (b *Balancer) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		b.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckHealth requests HealthCheckPath from every backend once, taking
+// those that fail out of the ring and putting those that answer back in.
+// Draining backends are left alone.
+func (b *Balancer) CheckHealth(ctx context.Context) {
+	b.mu.RLock()
+	backends := make(map[string]*backend, len(b.backends))
+	for name, be := range b.backends {
+		backends[name] = be
+	}
+	b.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, be := range backends {
+		wg.Add(1)
+		go func(name string, be *backend) {
+			defer wg.Done()
+			err := b.check(ctx, be)
+
+			n, ok := b.ring.Node(name)
+			switch {
+			case !ok || n.State == chash.NodeDraining:
+			case err != nil && n.State == chash.NodeActive:
+				b.logf("balancer: backend %s failed its health check: %v", name, err)
+				b.ring.SetState(name, chash.NodeDown)
+			case err == nil && n.State == chash.NodeDown:
+				b.ring.SetState(name, chash.NodeActive)
+			}
+		}(name, be)
+	}
+	wg.Wait()
+}
+
+func (b *Balancer) check(ctx context.Context, be *backend) error {
+	ctx, cancel := context.WithTimeout(ctx, b.opts.HealthCheckTimeout)
+	defer cancel()
+
+	u := *be.url
+	u.Path = singleJoiningSlash(u.Path, b.opts.HealthCheckPath)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.opts.Transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash, bslash := len(a) > 0 && a[len(a)-1] == '/', len(b) > 0 && b[0] == '/'
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func (b *Balancer) logf(format string, args ...interface{}) {
+	if b.opts.ErrorLog != nil {
+		b.opts.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
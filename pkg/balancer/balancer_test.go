@@ -0,0 +1,203 @@
+package balancer
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"dutil/pkg/chash"
+)
+
+// testBackend answers every request with its name, and health checks with
+// 503 while down is set.
+type testBackend struct {
+	*httptest.Server
+	down int32
+}
+
+func newTestBackend(name string) *testBackend {
+	be := &testBackend{}
+	be.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && atomic.LoadInt32(&be.down) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(name))
+	}))
+	return be
+}
+
+func get(t *testing.T, h http.Handler, user string) (int, string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/users/"+user, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	body, _ := ioutil.ReadAll(w.Body)
+	return w.Code, string(body)
+}
+
+func TestBalancer(t *testing.T) {
+	b := New(Options{
+		Key:             PathSegmentKey(1),
+		HealthCheckPath: "/healthz",
+		ErrorLog:        log.New(ioutil.Discard, "", 0),
+	})
+	if code, _ := get(t, b, "0"); code != http.StatusServiceUnavailable {
+		t.Fatalf("status without backends = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	backends := make(map[string]*testBackend)
+	for i := 0; i < 3; i++ {
+		name := "backend-" + strconv.Itoa(i)
+		backends[name] = newTestBackend(name)
+		defer backends[name].Close()
+		if err := b.AddBackend(backends[name].URL, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.AddBackend("localhost:80", 1); err != ErrInvalidBackend {
+		t.Fatalf("AddBackend() without scheme = %v, want %v", err, ErrInvalidBackend)
+	}
+
+	// Requests stick to a backend by key.
+	owners := make(map[string]string)
+	for i := 0; i < 30; i++ {
+		user := strconv.Itoa(i)
+		code, owner := get(t, b, user)
+		if code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", code, http.StatusOK)
+		}
+		if _, again := get(t, b, user); again != owner {
+			t.Fatalf("user %s went to %s, then to %s", user, owner, again)
+		}
+		owners[user] = owner
+	}
+
+	// A backend going away fails over, and is taken out of the ring.
+	gone := owners["0"]
+	backends[gone].Close()
+	for user, owner := range owners {
+		code, got := get(t, b, user)
+		if code != http.StatusOK {
+			t.Fatalf("status after failover = %d, want %d", code, http.StatusOK)
+		}
+		if owner != gone && got != owner {
+			t.Fatalf("user %s moved from %s to %s", user, owner, got)
+		}
+		if got == gone {
+			t.Fatalf("user %s still on %s", user, gone)
+		}
+	}
+	if n, _ := b.Ring().Node(backends[gone].URL); n.State != chash.NodeDown {
+		t.Fatalf("failed backend is %s, want down", n.State)
+	}
+
+	// Health checks take failing backends out and put them back in.
+	var other string
+	for name := range backends {
+		if name != gone {
+			other = name
+			break
+		}
+	}
+	atomic.StoreInt32(&backends[other].down, 1)
+	b.CheckHealth(context.Background())
+	if n, _ := b.Ring().Node(backends[other].URL); n.State != chash.NodeDown {
+		t.Fatalf("unhealthy backend is %s, want down", n.State)
+	}
+	atomic.StoreInt32(&backends[other].down, 0)
+	b.CheckHealth(context.Background())
+	if n, _ := b.Ring().Node(backends[other].URL); n.State != chash.NodeActive {
+		t.Fatalf("healthy backend is %s, want active", n.State)
+	}
+}
+
+func TestBalancerBoundedLoad(t *testing.T) {
+	b := New(Options{
+		Key:  HeaderKey("X-User"),
+		Ring: chash.RingOptions{LoadFactor: 0.25},
+	})
+	for i := 0; i < 2; i++ {
+		be := newTestBackend("backend-" + strconv.Itoa(i))
+		defer be.Close()
+		b.AddBackend(be.URL, 1)
+	}
+
+	// Every request is released once done, so a single key keeps its
+	// backend.
+	var first string
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", "alice")
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, r)
+		if i == 0 {
+			first = w.Body.String()
+		} else if w.Body.String() != first {
+			t.Fatalf("request %d went to %s, want %s", i, w.Body.String(), first)
+		}
+	}
+	for _, n := range b.Ring().Nodes() {
+		if load := b.Ring().Load(n.Name); load != 0 {
+			t.Fatalf("%s has a load of %d after all requests ended", n.Name, load)
+		}
+	}
+}
+
+func TestBalancerBoundedLoadFailover(t *testing.T) {
+	b := New(Options{
+		Key:      HeaderKey("X-User"),
+		Ring:     chash.RingOptions{LoadFactor: 0.25},
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	})
+	// Every backend answers with its own load while serving the request.
+	servers := make(map[string]*httptest.Server)
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			self := "http://" + r.Context().Value(http.LocalAddrContextKey).(net.Addr).String()
+			w.Write([]byte(strconv.FormatInt(b.Ring().Load(self), 10)))
+		}))
+		defer srv.Close()
+		servers[srv.URL] = srv
+		b.AddBackend(srv.URL, 1)
+	}
+
+	serve := func() (int, string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", "alice")
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+	if code, load := serve(); code != http.StatusOK || load != "1" {
+		t.Fatalf("request served with status %d and load %s, want %d and 1", code, load, http.StatusOK)
+	}
+
+	// The failover backend carries the request too.
+	servers[b.Ring().GetNode([]byte("alice"))].Close()
+	if code, load := serve(); code != http.StatusOK || load != "1" {
+		t.Fatalf("failover served with status %d and load %s, want %d and 1", code, load, http.StatusOK)
+	}
+	for _, n := range b.Ring().Nodes() {
+		if load := b.Ring().Load(n.Name); load != 0 {
+			t.Fatalf("%s has a load of %d after all requests ended", n.Name, load)
+		}
+	}
+
+	// With every backend gone the last failure is answered.
+	for _, srv := range servers {
+		srv.Close()
+	}
+	for _, n := range b.Ring().Nodes() {
+		b.Ring().SetState(n.Name, chash.NodeActive)
+	}
+	if code, _ := serve(); code != http.StatusBadGateway {
+		t.Fatalf("status with all backends gone = %d, want %d", code, http.StatusBadGateway)
+	}
+}
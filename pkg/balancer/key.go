@@ -0,0 +1,58 @@
+package balancer
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// KeyFunc returns the key a request is routed by, requests with the same
+// key go to the same backend. Requests without a key are routed by the
+// client address.
+type KeyFunc func(r *http.Request) []byte
+
+// HeaderKey routes by the value of the request header name.
+func HeaderKey(name string) KeyFunc {
+	return func(r *http.Request) []byte {
+		if v := r.Header.Get(name); v != "" {
+			return []byte(v)
+		}
+		return nil
+	}
+}
+
+// CookieKey routes by the value of the cookie name, such as a session id.
+func CookieKey(name string) KeyFunc {
+	return func(r *http.Request) []byte {
+		if c, err := r.Cookie(name); err == nil && c.Value != "" {
+			return []byte(c.Value)
+		}
+		return nil
+	}
+}
+
+// PathSegmentKey routes by the i-th segment of the URL path, counting from
+// 0, so PathSegmentKey(1) routes "/users/42/orders" by "42".
+func PathSegmentKey(i int) KeyFunc {
+	return func(r *http.Request) []byte {
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if i < 0 || i >= len(segments) || segments[i] == "" {
+			return nil
+		}
+		return []byte(segments[i])
+	}
+}
+
+// ClientIPKey routes by the IP address of the client. Behind another proxy
+// use a HeaderKey on the header it puts the client address in instead.
+func ClientIPKey() KeyFunc {
+	return clientIP
+}
+
+func clientIP(r *http.Request) []byte {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return []byte(r.RemoteAddr)
+	}
+	return []byte(host)
+}
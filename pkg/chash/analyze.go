@@ -0,0 +1,80 @@
+package chash
+
+import "math"
+
+// Distribution describes how a set of keys spreads over the nodes of a
+// CHash.
+type Distribution struct {
+	Keys  int
+	Nodes int
+	// Load is the number of keys per node, nodes owning none are missing.
+	Load map[string]int
+
+	Mean   float64 // keys per node
+	StdDev float64 // of the keys per node
+	Max    int     // keys on the busiest node
+}
+
+// MaxMean returns the load of the busiest node relative to the mean, 1 for
+// a perfect spread.
+func (d Distribution) MaxMean() float64 {
+	if d.Mean == 0 {
+		return 0
+	}
+	return float64(d.Max) / d.Mean
+}
+
+// Analyze looks up every key in h and returns how they spread over its
+// nodes.
+func Analyze(h CHash, keys [][]byte) Distribution {
+	d := Distribution{
+		Keys:  len(keys),
+		Nodes: int(h.GetNodeNum()),
+		Load:  make(map[string]int),
+	}
+	for _, key := range keys {
+		if node := h.GetNode(key); node != "" {
+			d.Load[node]++
+		}
+	}
+	if d.Nodes == 0 {
+		return d
+	}
+
+	d.Mean = float64(d.Keys) / float64(d.Nodes)
+	var sq float64
+	for _, n := range d.Load {
+		sq += (float64(n) - d.Mean) * (float64(n) - d.Mean)
+		if n > d.Max {
+			d.Max = n
+		}
+	}
+	// Nodes owning no keys are off by the whole mean.
+	sq += float64(d.Nodes-len(d.Load)) * d.Mean * d.Mean
+	d.StdDev = math.Sqrt(sq / float64(d.Nodes))
+	return d
+}
+
+// Moved applies change to h, typically adding or removing nodes, and
+// returns the fraction of keys that changed their owner by it. The least
+// a consistent hash can move when going from n to m nodes is |m-n| /
+// max(n, m).
+func Moved(h CHash, keys [][]byte, change func(h CHash) error) (float64, error) {
+	if len(keys) == 0 {
+		return 0, change(h)
+	}
+	owners := make([]string, len(keys))
+	for i, key := range keys {
+		owners[i] = h.GetNode(key)
+	}
+	if err := change(h); err != nil {
+		return 0, err
+	}
+	moved := 0
+	for i, key := range keys {
+		if h.GetNode(key) != owners[i] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(keys)), nil
+}
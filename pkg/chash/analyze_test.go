@@ -0,0 +1,53 @@
+package chash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	keys := make([][]byte, 10000)
+	for i := range keys {
+		keys[i] = []byte("key-" + strconv.Itoa(i))
+	}
+
+	h := NewRing(RingOptions{})
+	if d := Analyze(h, keys); d.Nodes != 0 || len(d.Load) != 0 || d.MaxMean() != 0 {
+		t.Fatalf("Analyze() of an empty ring = %+v", d)
+	}
+	for i := 0; i < 4; i++ {
+		h.AddNode("node-" + strconv.Itoa(i))
+	}
+
+	d := Analyze(h, keys)
+	if d.Keys != len(keys) || d.Nodes != 4 || d.Mean != 2500 {
+		t.Fatalf("Analyze() = %+v, want 10000 keys on 4 nodes", d)
+	}
+	var sum int
+	var sq float64
+	for _, n := range d.Load {
+		sum += n
+		sq += (float64(n) - d.Mean) * (float64(n) - d.Mean)
+	}
+	if sum != len(keys) {
+		t.Fatalf("loads add up to %d, want %d", sum, len(keys))
+	}
+	if want := math.Sqrt(sq / 4); math.Abs(d.StdDev-want) > 1e-9 {
+		t.Fatalf("StdDev = %v, want %v", d.StdDev, want)
+	}
+	if d.MaxMean() < 1 || d.MaxMean() > 1.2 {
+		t.Fatalf("MaxMean() = %v, want within [1, 1.2]", d.MaxMean())
+	}
+
+	moved, err := Moved(h, keys, func(h CHash) error { return h.AddNode("node-4") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved < 0.15 || moved > 0.25 {
+		t.Fatalf("adding a 5th node moved %.2f of the keys, want about 0.2", moved)
+	}
+	if _, err := Moved(h, keys, func(h CHash) error { return h.AddNode("node-4") }); err != ErrDuplicateNode {
+		t.Fatalf("Moved() = %v, want the error of the change", err)
+	}
+}
@@ -0,0 +1,84 @@
+package chash
+
+import "math"
+
+// This file implements "Consistent Hashing with Bounded Loads" by Mirrokni,
+// Thorup and Zadimoghaddam on top of the Ring: a key goes to its usual node
+// unless that node is full, then to the next node on the ring that is not.
+
+// Acquire assigns key to a node and adds one to that node's load. It is the
+// node GetNode returns, unless that one already carries its capacity or is
+// not active, in which case the ring is walked on to the first active node
+// below its capacity.
+// Every Acquire has to be paired with a Release of the returned node once
+// the assignment ends.
+func (r *Ring) Acquire(key []byte) (string, error) {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	s := r.Snapshot()
+	if s.totalWeight == 0 {
+		return "", ErrNoNodes
+	}
+
+	seen := make(map[string]bool, len(s.nodes))
+	start := s.search(s.opts.Hash.Sum32(key))
+	for i := 0; i < len(s.tokens); i++ {
+		node := s.tokens[(start+i)%len(s.tokens)].node
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		if s.nodes[node].State == NodeActive && r.loads[node] < r.capacity(s, node) {
+			r.loads[node]++
+			r.totalLoad++
+			return node, nil
+		}
+	}
+	// Unreachable, capacities of the active nodes add up to more than the
+	// load plus one.
+	return "", ErrNoNodes
+}
+
+// Release ends an assignment of Acquire to node.
+func (r *Ring) Release(node string) error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	if r.Snapshot().Weight(node) == 0 {
+		return ErrNodeNotFound
+	}
+	if r.loads[node] > 0 {
+		r.loads[node]--
+		r.totalLoad--
+	}
+	return nil
+}
+
+// Load returns the number of assignments node currently carries.
+func (r *Ring) Load(node string) int64 {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	return r.loads[node]
+}
+
+// Capacity returns the number of assignments node may carry before
+// Acquire passes it over: its weighted share among the active nodes of the
+// total load, plus the one being assigned, times 1+LoadFactor, rounded up.
+// Nodes that are not active take no assignments.
+func (r *Ring) Capacity(node string) int64 {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	s := r.Snapshot()
+	if n, ok := s.nodes[node]; !ok || n.State != NodeActive {
+		return 0
+	}
+	return r.capacity(s, node)
+}
+
+// capacity is Capacity of node on s, loadMu has to be held.
+func (r *Ring) capacity(s *RingSnapshot, node string) int64 {
+	share := float64(r.totalLoad+1) * float64(s.nodes[node].Weight) / float64(s.totalWeight)
+	return int64(math.Ceil(share * (1 + r.opts.LoadFactor)))
+}
@@ -0,0 +1,50 @@
+package chash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRingBoundedLoad(t *testing.T) {
+	r := NewRing(RingOptions{LoadFactor: 0.25})
+	if _, err := r.Acquire([]byte("key")); err != ErrNoNodes {
+		t.Fatalf("Acquire() on empty ring = %v, want %v", err, ErrNoNodes)
+	}
+	for i := 0; i < 4; i++ {
+		r.AddNode("node-" + strconv.Itoa(i))
+	}
+
+	// A single hot key spreads once its node is full.
+	assigned := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		node, err := r.Acquire([]byte("hot"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assigned[node]++
+	}
+	for node, n := range assigned {
+		if limit := r.Capacity(node); int64(n) > limit || r.Load(node) != int64(n) {
+			t.Fatalf("node %s carries %d (load %d), capacity %d", node, n, r.Load(node), limit)
+		}
+	}
+	if len(assigned) != 4 {
+		t.Fatalf("hot key landed on %d nodes, want 4", len(assigned))
+	}
+
+	// Freed capacity makes the key sticky again.
+	home := r.GetNode([]byte("hot"))
+	for node, n := range assigned {
+		for i := 0; i < n; i++ {
+			if err := r.Release(node); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if node, _ := r.Acquire([]byte("hot")); node != home {
+		t.Fatalf("Acquire() on idle ring = %s, want %s", node, home)
+	}
+	if err := r.Release("unknown"); err != ErrNodeNotFound {
+		t.Fatalf("Release() of unknown node = %v, want %v", err, ErrNodeNotFound)
+	}
+}
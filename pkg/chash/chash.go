@@ -1,11 +1,16 @@
 package chash
 
-import (
-	"hash"
-)
+import "errors"
 
 // this package implement the consistent hash
 
+var (
+	ErrDuplicateNode = errors.New("duplicate register node")
+	ErrNodeNotFound  = errors.New("node does not exist")
+	ErrInvalidWeight = errors.New("node weight must be positive")
+	ErrNoNodes       = errors.New("no nodes to choose from")
+)
+
 type CHash interface {
 	AddNode(node string) error
 	RemoveNode(node string) error
@@ -13,24 +18,11 @@ type CHash interface {
 	GetNodeNum() uint32
 }
 
-type murmur3CHash struct {
-	h hash.Hash32
-	s Set
-}
-
-func (m *murmur3CHash) AddNode(node string) error { return m.s.Add(node) }
-
-func (m *murmur3CHash) RemoveNode(node string) error { return m.s.Remove(node) }
-
-func (m *murmur3CHash) GetNode(p []byte) string {
-	// todo: hash32 compute
-	index := m.h.Sum32() % m.s.Len()
-	return m.s.Get(index)
-
-}
-
-func (m *murmur3CHash) GetNodeNum() uint32 { return m.s.Len() }
-
-func NewMurmur3CHash() *murmur3CHash {
-	return nil
+// ReplicaCHash is a CHash that also picks several distinct nodes per key,
+// to place replicas on.
+type ReplicaCHash interface {
+	CHash
+	// GetNodes returns up to n distinct nodes for key, the one GetNode
+	// returns first.
+	GetNodes(key []byte, n int) []string
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+
+	"dutil/pkg/murmur3"
 )
 
 func TestHash32WithSeed(t *testing.T) {
@@ -20,7 +22,7 @@ func TestHash32WithSeed(t *testing.T) {
 	}
 
 	for i := 0; i < 100; i++ {
-		res := hash32WithSeed([]byte(strconv.Itoa(i)), 0xa1)
+		res := murmur3.Sum32WithSeed([]byte(strconv.Itoa(i)), 0xa1)
 		fmt.Println(addressTable[res%uint32(len(addressTable))])
 	}
 }
@@ -0,0 +1,121 @@
+package chash
+
+import (
+	"errors"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+
+	"dutil/pkg/murmur3"
+)
+
+// Hash places keys and virtual nodes on a 32 bit ring. Its name and a
+// fingerprint of its output go into the ring checksum, so rings hashing
+// differently never compare equal and refuse each other's snapshots.
+type Hash struct {
+	name        string
+	sum         func(data []byte) uint32
+	fingerprint uint32
+}
+
+// ErrUnknownHash is returned when decoding a snapshot made with a hash
+// neither built in nor registered with RegisterHash.
+var ErrUnknownHash = errors.New("ring hash is not known, see RegisterHash")
+
+// fingerprintInput is hashed into the fingerprint of every Hash, to tell
+// apart functions that go by the same name.
+var fingerprintInput = []byte("dutil/pkg/chash fingerprint")
+
+var (
+	// FNV1a is the 32 bit FNV-1a hash.
+	FNV1a = NewHash32("fnv1a", fnv.New32a)
+	// CRC32 is the IEEE CRC-32 checksum.
+	CRC32 = NewHash32("crc32", crc32.NewIEEE)
+)
+
+func newHash(name string, sum func(data []byte) uint32) Hash {
+	return Hash{name: name, sum: sum, fingerprint: sum(fingerprintInput)}
+}
+
+// Murmur3 returns the 32 bit murmur3 hash with seed, the hash of a Ring
+// unless RingOptions say otherwise.
+func Murmur3(seed uint32) Hash {
+	return newHash("murmur3:"+strconv.FormatUint(uint64(seed), 10), func(data []byte) uint32 {
+		return murmur3.Sum32WithSeed(data, seed)
+	})
+}
+
+// NewHash32 returns a Hash summing with a fresh hash.Hash32 from factory,
+// name identifies it to other rings:
+//
+//	chash.NewHash32("adler32", func() hash.Hash32 { return adler32.New() })
+func NewHash32(name string, factory func() hash.Hash32) Hash {
+	return newHash(name, func(data []byte) uint32 {
+		h := factory()
+		h.Write(data)
+		return h.Sum32()
+	})
+}
+
+// NewHash64 returns a Hash summing with a fresh hash.Hash64 from factory
+// and folding the sum to 32 bits, name identifies it to other rings:
+//
+//	chash.NewHash64("xxhash", func() hash.Hash64 { return xxhash.New() })
+func NewHash64(name string, factory func() hash.Hash64) Hash {
+	return newHash(name, func(data []byte) uint32 {
+		h := factory()
+		h.Write(data)
+		sum := h.Sum64()
+		return uint32(sum>>32) ^ uint32(sum)
+	})
+}
+
+// Name returns the name of h.
+func (h Hash) Name() string { return h.name }
+
+// Sum32 hashes data.
+func (h Hash) Sum32(data []byte) uint32 { return h.sum(data) }
+
+// same reports whether h and o hash alike.
+func (h Hash) same(o Hash) bool {
+	return h.name == o.name && h.fingerprint == o.fingerprint
+}
+
+var (
+	hashesMu sync.RWMutex
+	hashes   = map[string]Hash{FNV1a.name: FNV1a, CRC32.name: CRC32}
+)
+
+// RegisterHash makes h known by its name to decoded snapshots. Hashes not
+// built into this package have to be registered before snapshots made with
+// them can be decoded.
+func RegisterHash(h Hash) {
+	hashesMu.Lock()
+	defer hashesMu.Unlock()
+	hashes[h.name] = h
+}
+
+// lookupHash returns the hash name stands for, built in or registered. It
+// fails with ErrUnknownHash for a name not known here, and with
+// ErrIncompatibleRings when the hash known by name hashes other than
+// fingerprint says.
+func lookupHash(name string, fingerprint uint32) (Hash, error) {
+	hashesMu.RLock()
+	h, ok := hashes[name]
+	hashesMu.RUnlock()
+	if !ok && strings.HasPrefix(name, "murmur3:") {
+		if seed, err := strconv.ParseUint(name[len("murmur3:"):], 10, 32); err == nil {
+			h, ok = Murmur3(uint32(seed)), true
+		}
+	}
+	if !ok {
+		return Hash{}, ErrUnknownHash
+	}
+	if h.fingerprint != fingerprint {
+		return Hash{}, ErrIncompatibleRings
+	}
+	return h, nil
+}
@@ -0,0 +1,97 @@
+package chash
+
+import (
+	"encoding/json"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"hash/crc64"
+	"strconv"
+	"testing"
+)
+
+func TestRingHash(t *testing.T) {
+	crc64ISO := NewHash64("crc64-iso", func() hash.Hash64 { return crc64.New(crc64.MakeTable(crc64.ISO)) })
+
+	rings := make(map[string]*Ring)
+	for _, h := range []Hash{Murmur3(0), Murmur3(1), FNV1a, CRC32, crc64ISO} {
+		r := NewRing(RingOptions{VirtualNodes: 40, Hash: h})
+		for i := 0; i < 5; i++ {
+			r.AddNode("node-" + strconv.Itoa(i))
+		}
+		rings[h.Name()] = r
+	}
+	if n := len(rings); n != 5 {
+		t.Fatalf("%d distinct hash names, want 5", n)
+	}
+	if NewRing(RingOptions{Seed: 1}).Snapshot().opts.Hash.Name() != "murmur3:1" {
+		t.Fatal("ring without a Hash does not default to murmur3 with its seed")
+	}
+
+	// Only the hash differs, so must the checksum.
+	checksums := make(map[uint64]string)
+	for name, r := range rings {
+		if other, ok := checksums[r.Snapshot().Checksum()]; ok {
+			t.Fatalf("rings hashed by %s and %s have the same checksum", name, other)
+		}
+		checksums[r.Snapshot().Checksum()] = name
+	}
+
+	// Built in hashes survive encoding, others have to be registered.
+	for name, r := range rings {
+		data, _ := r.Snapshot().MarshalBinary()
+		var s RingSnapshot
+		err := s.UnmarshalBinary(data)
+		if name == "crc64-iso" {
+			if err != ErrUnknownHash {
+				t.Fatalf("UnmarshalBinary() with an unknown hash = %v, want %v", err, ErrUnknownHash)
+			}
+			RegisterHash(crc64ISO)
+			err = s.UnmarshalBinary(data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := NewRingFromSnapshot(&s, RingOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameRing(t, r.Snapshot(), got.Snapshot())
+
+		if err := rings["fnv1a"].Replace(&s); name != "fnv1a" && err != ErrIncompatibleRings {
+			t.Fatalf("Replace() with a snapshot hashed by %s = %v, want %v", name, err, ErrIncompatibleRings)
+		}
+	}
+}
+
+func TestRegisterHash(t *testing.T) {
+	adler := NewHash32("adler32", func() hash.Hash32 { return adler32.New() })
+	r := NewRing(RingOptions{Hash: adler})
+	for i := 0; i < 3; i++ {
+		r.AddNode("node-" + strconv.Itoa(i))
+	}
+	data, err := json.Marshal(r.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s RingSnapshot
+	if err := json.Unmarshal(data, &s); err != ErrUnknownHash {
+		t.Fatalf("Unmarshal() with an unknown hash = %v, want %v", err, ErrUnknownHash)
+	}
+	RegisterHash(adler)
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.GetNode([]byte("key")), r.GetNode([]byte("key")); got != want {
+		t.Fatalf("GetNode() = %s on the decoded snapshot, want %s", got, want)
+	}
+
+	// Another function by the same name does not hash alike.
+	RegisterHash(NewHash32("adler32", crc32.NewIEEE))
+	defer RegisterHash(adler)
+	if err := json.Unmarshal(data, &s); err != ErrIncompatibleRings {
+		t.Fatalf("Unmarshal() with another hash by the same name = %v, want %v", err, ErrIncompatibleRings)
+	}
+}
@@ -0,0 +1,99 @@
+package chash
+
+import (
+	"errors"
+	"sync"
+
+	"dutil/pkg/murmur3"
+)
+
+var ErrNotLastNode = errors.New("only the last node can be removed from a jump hash")
+
+// JumpHash maps key onto one of buckets buckets, as described in "A Fast,
+// Minimal Memory, Consistent Hash Algorithm" by Lamping and Veach. Growing
+// buckets by one only moves 1/buckets of the keys, all of them into the new
+// bucket. It returns -1 when buckets is not positive.
+func JumpHash(key uint64, buckets int32) int32 {
+	if buckets <= 0 {
+		return -1
+	}
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int32(b)
+}
+
+// JumpCHash is a CHash on top of JumpHash for numbered shards that are only
+// ever appended. Bucket i is the i-th node added to the NodeSet, so only
+// the last node may be removed again. It needs no memory beyond the node
+// names.
+//
+// A JumpCHash is safe for concurrent use, lookups only take read locks.
+type JumpCHash struct {
+	mu   sync.Mutex // serializes membership changes
+	s    *NodeSet
+	seed uint32
+}
+
+var _ CHash = (*JumpCHash)(nil)
+
+// NewJumpCHash returns an empty jump hash, keys are hashed by murmur3 with
+// seed.
+func NewJumpCHash(seed uint32) *JumpCHash {
+	return &JumpCHash{s: NewNodeSet(), seed: seed}
+}
+
+func (j *JumpCHash) AddNode(node string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.s.Add(node)
+}
+
+// RemoveNode removes node, which has to be the last one added.
+func (j *JumpCHash) RemoveNode(node string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.s.Node(node); !ok {
+		return ErrNodeNotFound
+	}
+	if n := j.s.Len(); n == 0 || j.s.Get(n-1) != node {
+		return ErrNotLastNode
+	}
+	return j.s.Remove(node)
+}
+
+// SetState moves node into state, the keys of a down node are spread over
+// the others until it is up again.
+func (j *JumpCHash) SetState(node string, state NodeState) error {
+	return j.s.SetState(node, state)
+}
+
+// GetNode returns the node owning key, or an empty string when no node is
+// up.
+func (j *JumpCHash) GetNode(key []byte) string {
+	nodes := j.s.Nodes()
+	if len(nodes) == 0 {
+		return ""
+	}
+	// A key of a down bucket jumps again with the next seed, so the keys of
+	// the nodes that are up stay put.
+	for i := 0; i < len(nodes); i++ {
+		b := JumpHash(murmur3.Sum64WithSeed(key, j.seed+uint32(i)), int32(len(nodes)))
+		if !j.s.down(nodes[b]) {
+			return nodes[b]
+		}
+	}
+	// Unlucky or nearly all down, take the next node that is up.
+	start := JumpHash(murmur3.Sum64WithSeed(key, j.seed), int32(len(nodes)))
+	for i := range nodes {
+		if node := nodes[(int(start)+i)%len(nodes)]; !j.s.down(node) {
+			return node
+		}
+	}
+	return ""
+}
+
+func (j *JumpCHash) GetNodeNum() uint32 { return j.s.Len() }
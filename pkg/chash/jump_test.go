@@ -0,0 +1,130 @@
+package chash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestJumpHash(t *testing.T) {
+	for _, tc := range []struct {
+		key     uint64
+		buckets int32
+		want    int32
+	}{
+		{1, 1, 0},
+		{42, 57, 43},
+		{0xdead10cc, 1, 0},
+		{0xdead10cc, 666, 361},
+		{256, 1024, 520},
+	} {
+		if got := JumpHash(tc.key, tc.buckets); got != tc.want {
+			t.Errorf("JumpHash(%#x, %d) = %d, want %d", tc.key, tc.buckets, got, tc.want)
+		}
+	}
+	if got := JumpHash(1, 0); got != -1 {
+		t.Errorf("JumpHash(1, 0) = %d, want -1", got)
+	}
+}
+
+func TestJumpCHash(t *testing.T) {
+	j := NewJumpCHash(0)
+	for i := 0; i < 4; i++ {
+		j.AddNode("shard-" + strconv.Itoa(i))
+	}
+
+	owners := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = j.GetNode([]byte(key))
+	}
+
+	// Appending a shard only moves keys into it.
+	j.AddNode("shard-4")
+	moved := 0
+	for key, owner := range owners {
+		if node := j.GetNode([]byte(key)); node != owner {
+			if node != "shard-4" {
+				t.Fatalf("key %s moved from %s to %s", key, owner, node)
+			}
+			moved++
+		}
+	}
+	if share := float64(moved) / float64(len(owners)); share < 0.15 || share > 0.25 {
+		t.Fatalf("%.2f of the keys moved, want about 0.2", share)
+	}
+
+	if err := j.RemoveNode("shard-1"); err != ErrNotLastNode {
+		t.Fatalf("RemoveNode() of a middle shard = %v, want %v", err, ErrNotLastNode)
+	}
+	if err := j.RemoveNode("shard-9"); err != ErrNodeNotFound {
+		t.Fatalf("RemoveNode() of a missing shard = %v, want %v", err, ErrNodeNotFound)
+	}
+	if err := j.AddNode("shard-1"); err != ErrDuplicateNode {
+		t.Fatalf("AddNode() of a known shard = %v, want %v", err, ErrDuplicateNode)
+	}
+	if err := j.RemoveNode("shard-4"); err != nil {
+		t.Fatal(err)
+	}
+	for key, owner := range owners {
+		if node := j.GetNode([]byte(key)); node != owner {
+			t.Fatalf("key %s on %s after removing the new shard, want %s", key, node, owner)
+		}
+	}
+}
+
+func TestJumpCHashDown(t *testing.T) {
+	j := NewJumpCHash(0)
+	for i := 0; i < 4; i++ {
+		j.AddNode("shard-" + strconv.Itoa(i))
+	}
+	owners := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = j.GetNode([]byte(key))
+	}
+
+	if err := j.SetState("shard-1", NodeDown); err != nil {
+		t.Fatal(err)
+	}
+	// Only the keys of the down shard move, spread over the others.
+	spread := make(map[string]int)
+	for key, owner := range owners {
+		node := j.GetNode([]byte(key))
+		if node == "shard-1" {
+			t.Fatalf("key %s on the down shard", key)
+		}
+		if owner != "shard-1" && node != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+		if owner == "shard-1" {
+			spread[node]++
+		}
+	}
+	if len(spread) != 3 {
+		t.Fatalf("keys of the down shard went to %v, want all 3 others", spread)
+	}
+
+	for i := 0; i < 4; i++ {
+		j.SetState("shard-"+strconv.Itoa(i), NodeDown)
+	}
+	if node := j.GetNode([]byte("a")); node != "" {
+		t.Fatalf("GetNode() with all shards down = %q, want none", node)
+	}
+	j.SetState("shard-2", NodeActive)
+	if node := j.GetNode([]byte("a")); node != "shard-2" {
+		t.Fatalf("GetNode() with one shard up = %q, want shard-2", node)
+	}
+
+	// Back up, the keys return.
+	for i := 0; i < 4; i++ {
+		j.SetState("shard-"+strconv.Itoa(i), NodeActive)
+	}
+	for key, owner := range owners {
+		if node := j.GetNode([]byte(key)); node != owner {
+			t.Fatalf("key %s on %s after the shard came back, want %s", key, node, owner)
+		}
+	}
+	if err := j.SetState("shard-9", NodeDown); err != ErrNodeNotFound {
+		t.Fatalf("SetState() of a missing shard = %v, want %v", err, ErrNodeNotFound)
+	}
+}
@@ -0,0 +1,165 @@
+package chash
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+
+	"dutil/pkg/murmur3"
+)
+
+// DefaultMaglevTableSize is the lookup table size of a MaglevCHash unless
+// told otherwise, it has to be a prime well above the number of nodes.
+const DefaultMaglevTableSize = 65537
+
+var (
+	ErrTableSizeNotPrime = errors.New("maglev table size must be prime")
+	ErrTableFull         = errors.New("maglev table is smaller than the number of nodes")
+)
+
+// MaglevCHash is the consistent hash of Google's Maglev load balancer. Each
+// node derives a permutation of a prime sized lookup table from its name
+// and the nodes take turns claiming their next free slot, so every node
+// owns nearly the same number of slots and a lookup is a single table
+// access. The table is rebuilt on every membership change, which moves a
+// little more than the minimum of keys.
+//
+// A MaglevCHash is safe for concurrent use.
+type MaglevCHash struct {
+	mu    sync.RWMutex
+	size  uint64
+	seed  uint32
+	nodes []string // sorted, so every process builds the same table
+	table []int    // slot -> index into nodes
+	// Number of slots whose owner changed by the last rebuild.
+	changed int
+}
+
+var _ CHash = (*MaglevCHash)(nil)
+
+// NewMaglevCHash returns an empty maglev hash with a lookup table of size
+// slots, DefaultMaglevTableSize if zero. Keys and nodes are hashed by
+// murmur3 with seed.
+func NewMaglevCHash(size uint64, seed uint32) (*MaglevCHash, error) {
+	if size == 0 {
+		size = DefaultMaglevTableSize
+	}
+	if !new(big.Int).SetUint64(size).ProbablyPrime(0) {
+		return nil, ErrTableSizeNotPrime
+	}
+	return &MaglevCHash{size: size, seed: seed}, nil
+}
+
+func (m *MaglevCHash) AddNode(node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.SearchStrings(m.nodes, node)
+	if i < len(m.nodes) && m.nodes[i] == node {
+		return ErrDuplicateNode
+	}
+	if uint64(len(m.nodes)) >= m.size {
+		return ErrTableFull
+	}
+	nodes := make([]string, 0, len(m.nodes)+1)
+	nodes = append(append(append(nodes, m.nodes[:i]...), node), m.nodes[i:]...)
+	m.rebuild(nodes)
+	return nil
+}
+
+func (m *MaglevCHash) RemoveNode(node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.SearchStrings(m.nodes, node)
+	if i == len(m.nodes) || m.nodes[i] != node {
+		return ErrNodeNotFound
+	}
+	nodes := make([]string, 0, len(m.nodes)-1)
+	nodes = append(append(nodes, m.nodes[:i]...), m.nodes[i+1:]...)
+	m.rebuild(nodes)
+	return nil
+}
+
+// rebuild populates a new lookup table for nodes.
+func (m *MaglevCHash) rebuild(nodes []string) {
+	var table []int
+	if len(nodes) > 0 {
+		table = m.populate(nodes)
+	}
+
+	changed := 0
+	for slot := uint64(0); slot < m.size; slot++ {
+		var before, after string
+		if m.table != nil {
+			before = m.nodes[m.table[slot]]
+		}
+		if table != nil {
+			after = nodes[table[slot]]
+		}
+		if before != after {
+			changed++
+		}
+	}
+
+	m.nodes, m.table, m.changed = nodes, table, changed
+}
+
+// populate fills the table the way the Maglev paper describes: the nodes
+// take turns to claim the next slot of their permutation not taken yet.
+func (m *MaglevCHash) populate(nodes []string) []int {
+	offset := make([]uint64, len(nodes))
+	skip := make([]uint64, len(nodes))
+	next := make([]uint64, len(nodes))
+	for i, node := range nodes {
+		h1, h2 := murmur3.Sum128WithSeed([]byte(node), m.seed)
+		offset[i] = h1 % m.size
+		skip[i] = h2%(m.size-1) + 1
+	}
+
+	table := make([]int, m.size)
+	for slot := range table {
+		table[slot] = -1
+	}
+	for filled := uint64(0); ; {
+		for i := range nodes {
+			slot := (offset[i] + next[i]*skip[i]) % m.size
+			for table[slot] >= 0 {
+				next[i]++
+				slot = (offset[i] + next[i]*skip[i]) % m.size
+			}
+			table[slot] = i
+			next[i]++
+			if filled++; filled == m.size {
+				return table
+			}
+		}
+	}
+}
+
+// GetNode returns the node owning key, or an empty string without nodes.
+func (m *MaglevCHash) GetNode(key []byte) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.nodes) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[murmur3.Sum64WithSeed(key, m.seed)%m.size]]
+}
+
+func (m *MaglevCHash) GetNodeNum() uint32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return uint32(len(m.nodes))
+}
+
+// TableSize returns the number of slots of the lookup table.
+func (m *MaglevCHash) TableSize() uint64 { return m.size }
+
+// Changed returns the number of table slots that changed their node with
+// the last AddNode or RemoveNode, the share of keys that moved is
+// Changed()/TableSize().
+func (m *MaglevCHash) Changed() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.changed
+}
@@ -0,0 +1,64 @@
+package chash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestMaglev(t *testing.T) {
+	if _, err := NewMaglevCHash(65536, 0); err != ErrTableSizeNotPrime {
+		t.Fatalf("NewMaglevCHash(65536) = %v, want %v", err, ErrTableSizeNotPrime)
+	}
+	m, err := NewMaglevCHash(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node := m.GetNode([]byte("key")); node != "" {
+		t.Fatalf("GetNode() without nodes = %q, want empty", node)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := m.AddNode("node-" + strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.AddNode("node-0"); err != ErrDuplicateNode {
+		t.Fatalf("AddNode() duplicate = %v, want %v", err, ErrDuplicateNode)
+	}
+
+	// Every node owns about a tenth of the slots.
+	slots := make(map[string]int)
+	for _, i := range m.table {
+		slots[m.nodes[i]]++
+	}
+	for node, n := range slots {
+		if share := float64(n) / float64(m.TableSize()); share < 0.095 || share > 0.105 {
+			t.Errorf("node %s owns %.3f of the table", node, share)
+		}
+	}
+
+	owners := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = m.GetNode([]byte(key))
+	}
+	if err := m.RemoveNode("node-4"); err != nil {
+		t.Fatal(err)
+	}
+	if share := float64(m.Changed()) / float64(m.TableSize()); share < 0.1 || share > 0.15 {
+		t.Fatalf("removing one of 10 nodes changed %.3f of the table", share)
+	}
+	moved := 0
+	for key, owner := range owners {
+		node := m.GetNode([]byte(key))
+		if node == "node-4" {
+			t.Fatalf("key %s still on the removed node", key)
+		}
+		if node != owner {
+			moved++
+		}
+	}
+	if share := float64(moved) / float64(len(owners)); share > 0.15 {
+		t.Fatalf("%.3f of the keys moved", share)
+	}
+}
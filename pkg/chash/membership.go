@@ -0,0 +1,147 @@
+package chash
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// DefaultSuspectGrace is how long a suspect node stays on the ring unless
+// MembershipOptions says otherwise.
+const DefaultSuspectGrace = 30 * time.Second
+
+// MembershipOptions configures a Membership.
+type MembershipOptions struct {
+	// SuspectGrace is how long a suspect node stays on the ring before it
+	// is removed, unless it is found alive again meanwhile.
+	SuspectGrace time.Duration
+
+	// NodeName maps a memberlist node to its name on the ring, the node's
+	// Name when nil.
+	NodeName func(n *memberlist.Node) string
+}
+
+// Membership keeps the nodes of a CHash in line with the events of a
+// gossip layer: joined nodes are added, nodes that left are removed, and
+// suspect nodes are removed after a grace period unless they come back.
+//
+// It is a memberlist.EventDelegate, hook it up with
+//
+//	conf := memberlist.DefaultLANConfig()
+//	conf.Events = chash.NewMembership(ring, chash.MembershipOptions{})
+//
+// Memberlist reports a node failing to answer as having left in state
+// dead, which Membership takes as suspect.
+type Membership struct {
+	h    CHash
+	opts MembershipOptions
+
+	mu       sync.Mutex
+	suspects map[string]*time.Timer
+}
+
+var _ memberlist.EventDelegate = (*Membership)(nil)
+
+// NewMembership returns a Membership maintaining the nodes of h.
+func NewMembership(h CHash, opts MembershipOptions) *Membership {
+	if opts.SuspectGrace <= 0 {
+		opts.SuspectGrace = DefaultSuspectGrace
+	}
+	if opts.NodeName == nil {
+		opts.NodeName = func(n *memberlist.Node) string { return n.Name }
+	}
+	return &Membership{
+		h:        h,
+		opts:     opts,
+		suspects: make(map[string]*time.Timer),
+	}
+}
+
+// Join adds node, or clears the suspicion on it.
+func (m *Membership) Join(node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clearSuspect(node)
+	if err := m.h.AddNode(node); err != nil && err != ErrDuplicateNode {
+		return err
+	}
+	return nil
+}
+
+// Leave removes node right away.
+func (m *Membership) Leave(node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clearSuspect(node)
+	if err := m.h.RemoveNode(node); err != nil && err != ErrNodeNotFound {
+		return err
+	}
+	return nil
+}
+
+// Suspect removes node once SuspectGrace passed without it joining again.
+func (m *Membership) Suspect(node string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.suspects[node]; ok {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(m.opts.SuspectGrace, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// Cleared or suspected anew while firing.
+		if m.suspects[node] != t {
+			return
+		}
+		delete(m.suspects, node)
+		m.h.RemoveNode(node)
+	})
+	m.suspects[node] = t
+}
+
+// Suspects returns the nodes currently suspected.
+func (m *Membership) Suspects() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := make([]string, 0, len(m.suspects))
+	for node := range m.suspects {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// clearSuspect stops the removal of node, m.mu has to be held.
+func (m *Membership) clearSuspect(node string) {
+	if t, ok := m.suspects[node]; ok {
+		t.Stop()
+		delete(m.suspects, node)
+	}
+}
+
+// NotifyJoin implements memberlist.EventDelegate.
+func (m *Membership) NotifyJoin(n *memberlist.Node) {
+	m.Join(m.opts.NodeName(n))
+}
+
+// NotifyLeave implements memberlist.EventDelegate.
+func (m *Membership) NotifyLeave(n *memberlist.Node) {
+	if n.State == memberlist.StateLeft {
+		m.Leave(m.opts.NodeName(n))
+		return
+	}
+	m.Suspect(m.opts.NodeName(n))
+}
+
+// NotifyUpdate implements memberlist.EventDelegate.
+func (m *Membership) NotifyUpdate(n *memberlist.Node) {
+	if n.State == memberlist.StateAlive {
+		m.Join(m.opts.NodeName(n))
+	}
+}
@@ -0,0 +1,69 @@
+package chash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+func TestMembership(t *testing.T) {
+	r := NewRing(RingOptions{VirtualNodes: 10})
+	m := NewMembership(r, MembershipOptions{SuspectGrace: 50 * time.Millisecond})
+
+	for _, name := range []string{"a", "b", "c"} {
+		m.NotifyJoin(&memberlist.Node{Name: name, State: memberlist.StateAlive})
+	}
+	if n := r.GetNodeNum(); n != 3 {
+		t.Fatalf("ring has %d nodes after 3 joins", n)
+	}
+
+	// A graceful leave removes right away.
+	m.NotifyLeave(&memberlist.Node{Name: "a", State: memberlist.StateLeft})
+	if r.Weight("a") != 0 {
+		t.Fatal("node that left is still on the ring")
+	}
+
+	// A suspect node stays for the grace period, and for good if it comes
+	// back meanwhile.
+	m.NotifyLeave(&memberlist.Node{Name: "b", State: memberlist.StateDead})
+	m.NotifyLeave(&memberlist.Node{Name: "c", State: memberlist.StateDead})
+	if r.GetNodeNum() != 2 || len(m.Suspects()) != 2 {
+		t.Fatalf("ring has %d nodes and %d suspects, want 2 and 2", r.GetNodeNum(), len(m.Suspects()))
+	}
+	m.NotifyJoin(&memberlist.Node{Name: "b", State: memberlist.StateAlive})
+
+	time.Sleep(150 * time.Millisecond)
+	if r.Weight("b") == 0 {
+		t.Fatal("node that came back was removed")
+	}
+	if r.Weight("c") != 0 {
+		t.Fatal("suspect node still on the ring after the grace period")
+	}
+	if len(m.Suspects()) != 0 {
+		t.Fatalf("suspects left: %v", m.Suspects())
+	}
+}
+
+func TestMembershipJump(t *testing.T) {
+	j := NewJumpCHash(0)
+	m := NewMembership(j, MembershipOptions{})
+
+	for _, name := range []string{"a", "b", "a"} {
+		if err := m.Join(name); err != nil {
+			t.Fatalf("Join(%s) = %v", name, err)
+		}
+	}
+	if err := m.Leave("c"); err != nil {
+		t.Fatalf("Leave() of an unknown node = %v", err)
+	}
+	if err := m.Leave("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Leave("b"); err != nil {
+		t.Fatalf("Leave() twice = %v", err)
+	}
+	if n := len(j.s.Nodes()); n != 1 {
+		t.Fatalf("jump hash has %d nodes, want 1", n)
+	}
+}
@@ -0,0 +1,107 @@
+package chash
+
+import (
+	"sort"
+	"sync"
+
+	"dutil/pkg/murmur3"
+)
+
+// DefaultProbes is the number of probes per key of a MultiProbeCHash when
+// none is given, it keeps the busiest node within about 5% of the mean.
+const DefaultProbes = 21
+
+// point is the single place of a node on a MultiProbeCHash.
+type point struct {
+	hash uint32
+	node string
+}
+
+// MultiProbeCHash is multi-probe consistent hashing: every node owns one
+// point on a 32 bit ring, and a key is hashed probes times with different
+// seeds. The node whose point follows one of the probes most closely owns
+// the key. It balances about as well as a Ring with many virtual nodes at
+// a fraction of the memory, one point per node, for lookups costing
+// probes binary searches.
+//
+// A MultiProbeCHash is safe for concurrent use.
+type MultiProbeCHash struct {
+	mu     sync.RWMutex
+	seed   uint32
+	probes int
+	points []point // sorted by hash
+}
+
+var _ CHash = (*MultiProbeCHash)(nil)
+
+// NewMultiProbeCHash returns an empty multi-probe hash probing every key
+// probes times, DefaultProbes if not positive. Probe i hashes the key by
+// murmur3 with seed+i+1, nodes are hashed with seed.
+func NewMultiProbeCHash(probes int, seed uint32) *MultiProbeCHash {
+	if probes <= 0 {
+		probes = DefaultProbes
+	}
+	return &MultiProbeCHash{seed: seed, probes: probes}
+}
+
+// Probes returns the number of probes per key.
+func (m *MultiProbeCHash) Probes() int { return m.probes }
+
+func (m *MultiProbeCHash) AddNode(node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.points {
+		if p.node == node {
+			return ErrDuplicateNode
+		}
+	}
+	m.points = append(m.points, point{hash: murmur3.Sum32WithSeed([]byte(node), m.seed), node: node})
+	sort.Slice(m.points, func(i, j int) bool {
+		if m.points[i].hash != m.points[j].hash {
+			return m.points[i].hash < m.points[j].hash
+		}
+		return m.points[i].node < m.points[j].node
+	})
+	return nil
+}
+
+func (m *MultiProbeCHash) RemoveNode(node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, p := range m.points {
+		if p.node == node {
+			m.points = append(m.points[:i], m.points[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNodeNotFound
+}
+
+// GetNode returns the node owning key, or an empty string without nodes.
+func (m *MultiProbeCHash) GetNode(key []byte) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.points) == 0 {
+		return ""
+	}
+
+	best, bestDist := 0, ^uint32(0)
+	for i := 0; i < m.probes; i++ {
+		h := murmur3.Sum32WithSeed(key, m.seed+uint32(i)+1)
+		j := sort.Search(len(m.points), func(j int) bool { return m.points[j].hash >= h })
+		if j == len(m.points) {
+			j = 0
+		}
+		// Wraps around past the end of the ring.
+		if dist := m.points[j].hash - h; dist < bestDist {
+			best, bestDist = j, dist
+		}
+	}
+	return m.points[best].node
+}
+
+func (m *MultiProbeCHash) GetNodeNum() uint32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return uint32(len(m.points))
+}
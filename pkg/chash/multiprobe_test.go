@@ -0,0 +1,52 @@
+package chash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestMultiProbe(t *testing.T) {
+	m := NewMultiProbeCHash(0, 0)
+	if m.GetNode([]byte("key")) != "" {
+		t.Fatal("GetNode() on an empty hash returned a node")
+	}
+	const nodes = 10
+	for i := 0; i < nodes; i++ {
+		if err := m.AddNode("node-" + strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.AddNode("node-0"); err != ErrDuplicateNode {
+		t.Fatalf("AddNode() of a known node = %v, want %v", err, ErrDuplicateNode)
+	}
+
+	const keys = 100000
+	owners := make(map[string]string)
+	load := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = m.GetNode([]byte(key))
+		load[owners[key]]++
+	}
+	if len(load) != nodes {
+		t.Fatalf("keys spread over %d nodes, want %d", len(load), nodes)
+	}
+	for node, n := range load {
+		if ratio := float64(n) * nodes / keys; ratio > 1.25 {
+			t.Fatalf("%s owns %.2f times the mean load", node, ratio)
+		}
+	}
+
+	if err := m.RemoveNode("node-3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveNode("node-3"); err != ErrNodeNotFound {
+		t.Fatalf("RemoveNode() of an unknown node = %v, want %v", err, ErrNodeNotFound)
+	}
+	for key, owner := range owners {
+		node := m.GetNode([]byte(key))
+		if owner != "node-3" && node != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+	}
+}
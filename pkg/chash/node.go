@@ -0,0 +1,159 @@
+package chash
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidState = errors.New("invalid node state")
+
+// NodeState is the lifecycle state of a node.
+type NodeState int
+
+const (
+	// NodeActive nodes own their keys and take new ones.
+	NodeActive NodeState = iota
+	// NodeDraining nodes keep serving the keys they own while these are
+	// migrated away, but get no new assignments.
+	NodeDraining
+	// NodeDown nodes are skipped by lookups, their keys go to the next
+	// node, until they are back up. They keep their place on the ring.
+	NodeDown
+)
+
+var nodeStates = [...]string{
+	NodeActive:   "active",
+	NodeDraining: "draining",
+	NodeDown:     "down",
+}
+
+func (s NodeState) String() string {
+	if s < 0 || int(s) >= len(nodeStates) {
+		return fmt.Sprintf("NodeState(%d)", int(s))
+	}
+	return nodeStates[s]
+}
+
+// MarshalText encodes s by its name.
+func (s NodeState) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(nodeStates) {
+		return nil, ErrInvalidState
+	}
+	return []byte(nodeStates[s]), nil
+}
+
+// UnmarshalText decodes a state encoded by MarshalText.
+func (s *NodeState) UnmarshalText(text []byte) error {
+	for i, name := range nodeStates {
+		if name == string(text) {
+			*s = NodeState(i)
+			return nil
+		}
+	}
+	return ErrInvalidState
+}
+
+// Node is a member of a consistent hash with its metadata.
+type Node struct {
+	Name   string
+	Addr   string // where to reach the node, host:port or a URL
+	Zone   string // failure domain, see RingOptions.DistinctZones
+	Weight int    // share of the keys relative to other nodes, 1 if zero
+	Tags   map[string]string
+	State  NodeState
+}
+
+// clone returns a copy of n with its own Tags and the default weight
+// filled in.
+func (n Node) clone() Node {
+	if n.Weight == 0 {
+		n.Weight = 1
+	}
+	if n.Tags != nil {
+		tags := make(map[string]string, len(n.Tags))
+		for k, v := range n.Tags {
+			tags[k] = v
+		}
+		n.Tags = tags
+	}
+	return n
+}
+
+// validate reports why n cannot be added, if at all.
+func (n Node) validate() error {
+	if n.Weight < 0 {
+		return ErrInvalidWeight
+	}
+	if n.State < NodeActive || n.State > NodeDown {
+		return ErrInvalidState
+	}
+	return nil
+}
+
+// SetState moves node into state. Keys only move away from a node going
+// down and back to it coming up again, draining moves none.
+func (r *Ring) SetState(node string, state NodeState) error {
+	if state < NodeActive || state > NodeDown {
+		return ErrInvalidState
+	}
+	return r.update(func(s *RingSnapshot) error {
+		n, ok := s.nodes[node]
+		if !ok {
+			return ErrNodeNotFound
+		}
+		if n.State == NodeActive {
+			s.totalWeight -= n.Weight
+		}
+		if state == NodeActive {
+			s.totalWeight += n.Weight
+		}
+		n.State = state
+		s.nodes[node] = n
+		return nil
+	})
+}
+
+// Node returns node with its metadata.
+func (r *Ring) Node(node string) (Node, bool) { return r.Snapshot().Node(node) }
+
+// Nodes returns all nodes with their metadata, ordered by name.
+func (r *Ring) Nodes() []Node { return r.Snapshot().Nodes() }
+
+// Node returns node with its metadata.
+func (s *RingSnapshot) Node(node string) (Node, bool) {
+	n, ok := s.nodes[node]
+	if !ok {
+		return Node{}, false
+	}
+	return n.clone(), true
+}
+
+// Nodes returns all nodes with their metadata, ordered by name.
+func (s *RingSnapshot) Nodes() []Node {
+	nodes := make([]Node, 0, len(s.nodes))
+	for _, name := range s.sortedNodes() {
+		nodes = append(nodes, s.nodes[name].clone())
+	}
+	return nodes
+}
+
+// Assign returns the node new keys hashing to key go to: the owner of key
+// unless that is draining, then the next active node on the ring. Lookups
+// of existing keys use GetNode, which keeps answering with draining nodes.
+func (s *RingSnapshot) Assign(key []byte) string {
+	if len(s.tokens) == 0 {
+		return ""
+	}
+	start := s.search(s.opts.Hash.Sum32(key))
+	for i := 0; i < len(s.tokens); i++ {
+		t := s.tokens[(start+i)%len(s.tokens)]
+		if s.nodes[t.node].State == NodeActive {
+			return t.node
+		}
+	}
+	return ""
+}
+
+// Assign returns the node new keys hashing to key go to, see
+// RingSnapshot.Assign.
+func (r *Ring) Assign(key []byte) string { return r.Snapshot().Assign(key) }
@@ -0,0 +1,119 @@
+package chash
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestRingNodeStates(t *testing.T) {
+	r := NewRing(RingOptions{VirtualNodes: 50})
+	for i := 0; i < 4; i++ {
+		err := r.Add(Node{
+			Name: "node-" + strconv.Itoa(i),
+			Addr: "10.0.0." + strconv.Itoa(i) + ":8000",
+			Tags: map[string]string{"rack": strconv.Itoa(i % 2)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Add(Node{Name: "bad", State: NodeState(7)}); err != ErrInvalidState {
+		t.Fatalf("Add() with an unknown state = %v, want %v", err, ErrInvalidState)
+	}
+	n, ok := r.Node("node-1")
+	if !ok || n.Addr != "10.0.0.1:8000" || n.Weight != 1 || n.Tags["rack"] != "1" || n.State != NodeActive {
+		t.Fatalf("Node() = %+v, %v", n, ok)
+	}
+	n.Tags["rack"] = "changed"
+	if n, _ := r.Node("node-1"); n.Tags["rack"] != "1" {
+		t.Fatal("tags returned by Node() are shared with the ring")
+	}
+
+	owners := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = r.GetNode([]byte(key))
+	}
+
+	// Draining keeps existing keys in place but takes no new ones.
+	r.SetState("node-1", NodeDraining)
+	// Down moves the keys away, to where they would go without the node.
+	r.SetState("node-2", NodeDown)
+	without := NewRing(RingOptions{VirtualNodes: 50})
+	for _, node := range []string{"node-0", "node-1", "node-3"} {
+		without.AddNode(node)
+	}
+	for key, owner := range owners {
+		node := r.GetNode([]byte(key))
+		switch {
+		case owner == "node-2" && node != without.GetNode([]byte(key)):
+			t.Fatalf("key %s of a down node went to %s, want %s", key, node, without.GetNode([]byte(key)))
+		case owner != "node-2" && node != owner:
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+		if a := r.Assign([]byte(key)); a == "node-1" || a == "node-2" {
+			t.Fatalf("Assign(%s) = %s, a node that is not active", key, a)
+		}
+		for _, replica := range r.GetNodes([]byte(key), 3) {
+			if replica == "node-2" {
+				t.Fatalf("GetNodes(%s) returned a down node", key)
+			}
+		}
+	}
+	for i := 0; i < 100; i++ {
+		node, err := r.Acquire([]byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node != "node-0" && node != "node-3" {
+			t.Fatalf("Acquire() = %s, a node that is not active", node)
+		}
+	}
+	if r.Capacity("node-1") != 0 {
+		t.Fatal("a draining node has capacity")
+	}
+
+	// States survive a snapshot round trip.
+	data, err := json.Marshal(r.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s RingSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	checkSameRing(t, r.Snapshot(), &s)
+	if n, _ := s.Node("node-2"); n.State != NodeDown || n.Addr != "10.0.0.2:8000" {
+		t.Fatalf("decoded node = %+v", n)
+	}
+
+	r.SetState("node-2", NodeActive)
+	for key, owner := range owners {
+		if node := r.GetNode([]byte(key)); node != owner {
+			t.Fatalf("key %s on %s after coming back up, want %s", key, node, owner)
+		}
+	}
+}
+
+func TestNodeSetMetadata(t *testing.T) {
+	s := NewNodeSet()
+	s.Add("a")
+	s.AddNode(Node{Name: "b", Zone: "z1", Weight: 2})
+	if n, ok := s.Node("a"); !ok || n.Weight != 1 || n.State != NodeActive {
+		t.Fatalf("Node(a) = %+v, %v", n, ok)
+	}
+	if err := s.SetState("b", NodeDraining); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Node("b"); n.State != NodeDraining || n.Zone != "z1" {
+		t.Fatalf("Node(b) = %+v", n)
+	}
+	if err := s.SetState("c", NodeDown); err != ErrNodeNotFound {
+		t.Fatalf("SetState() of an unknown node = %v, want %v", err, ErrNodeNotFound)
+	}
+	s.Remove("b")
+	if _, ok := s.Node("b"); ok {
+		t.Fatal("metadata of a removed node is still there")
+	}
+}
@@ -0,0 +1,90 @@
+package chash
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrIncompatibleRings = errors.New("rings hash keys differently")
+
+// Move is a range of key hashes that changed its owner between two rings.
+// It covers the hashes after Start up to and including End, wrapping around
+// the end of the ring when End is not greater than Start, so Start == End
+// covers the whole ring.
+type Move struct {
+	Start, End uint32
+	From, To   string // empty when the ring had no node up
+}
+
+// Contains reports whether the key hash h falls into m.
+func (m Move) Contains(h uint32) bool {
+	if m.Start < m.End {
+		return h > m.Start && h <= m.End
+	}
+	return h > m.Start || h <= m.End
+}
+
+// Hash returns the position of key on the ring, as matched against Move.
+func (s *RingSnapshot) Hash(key []byte) uint32 {
+	return s.opts.Hash.Sum32(key)
+}
+
+// Rebalance returns the ranges of key hashes whose owner differs between
+// the rings before and after, in ring order, so the keys in them can be
+// moved from the old owner to the new one:
+//
+//	before := ring.Snapshot()
+//	ring.AddNode("10.0.0.9:8000")
+//	moves, err := chash.Rebalance(before, ring.Snapshot())
+//
+// Both rings have to use the same Hash.
+func Rebalance(before, after *RingSnapshot) ([]Move, error) {
+	if !before.opts.Hash.same(after.opts.Hash) {
+		return nil, ErrIncompatibleRings
+	}
+
+	// Ownership can only change at tokens of either ring, between two
+	// neighbouring tokens both rings keep the same owner.
+	bounds := make([]uint32, 0, len(before.tokens)+len(after.tokens))
+	for _, t := range before.tokens {
+		bounds = append(bounds, t.hash)
+	}
+	for _, t := range after.tokens {
+		bounds = append(bounds, t.hash)
+	}
+	if len(bounds) == 0 {
+		return nil, nil
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	n := 1
+	for _, b := range bounds[1:] {
+		if b != bounds[n-1] {
+			bounds[n] = b
+			n++
+		}
+	}
+	bounds = bounds[:n]
+
+	var moves []Move
+	prev := bounds[len(bounds)-1]
+	for _, b := range bounds {
+		from, to := before.owner(b), after.owner(b)
+		if from != to {
+			if last := len(moves) - 1; last >= 0 && moves[last].End == prev &&
+				moves[last].From == from && moves[last].To == to {
+				moves[last].End = b
+			} else {
+				moves = append(moves, Move{Start: prev, End: b, From: from, To: to})
+			}
+		}
+		prev = b
+	}
+
+	// The first range may continue the last one across the end of the ring.
+	if last := len(moves) - 1; last > 0 && moves[last].End == moves[0].Start &&
+		moves[last].From == moves[0].From && moves[last].To == moves[0].To {
+		moves[0].Start = moves[last].Start
+		moves = moves[:last]
+	}
+	return moves, nil
+}
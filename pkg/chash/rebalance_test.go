@@ -0,0 +1,75 @@
+package chash
+
+import (
+	"strconv"
+	"testing"
+)
+
+// checkMoves verifies that exactly the keys whose owner changed between
+// before and after fall into one of moves, with matching owners.
+func checkMoves(t *testing.T, before, after *RingSnapshot, moves []Move) {
+	t.Helper()
+	for i := 0; i < 10000; i++ {
+		key := []byte(strconv.Itoa(i))
+		from, to := before.GetNode(key), after.GetNode(key)
+
+		var found []Move
+		for _, m := range moves {
+			if m.Contains(after.Hash(key)) {
+				found = append(found, m)
+			}
+		}
+		switch {
+		case from == to && len(found) != 0:
+			t.Fatalf("key %s stayed on %s but is in %v", key, from, found)
+		case from != to && len(found) != 1:
+			t.Fatalf("key %s moved from %s to %s but is in %v", key, from, to, found)
+		case from != to && (found[0].From != from || found[0].To != to):
+			t.Fatalf("key %s moved from %s to %s but is in %v", key, from, to, found[0])
+		}
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	r := NewRing(RingOptions{VirtualNodes: 50})
+	for i := 0; i < 4; i++ {
+		r.AddNode("node-" + strconv.Itoa(i))
+	}
+
+	before := r.Snapshot()
+	r.AddNode("node-4")
+	moves, err := Rebalance(before, r.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range moves {
+		if m.To != "node-4" {
+			t.Fatalf("adding node-4 moved %v", m)
+		}
+	}
+	checkMoves(t, before, r.Snapshot(), moves)
+
+	before = r.Snapshot()
+	r.RemoveNode("node-1")
+	r.SetWeight("node-2", 2)
+	moves, _ = Rebalance(before, r.Snapshot())
+	checkMoves(t, before, r.Snapshot(), moves)
+
+	if moves, _ = Rebalance(r.Snapshot(), r.Snapshot()); len(moves) != 0 {
+		t.Fatalf("Rebalance() of equal rings = %v, want none", moves)
+	}
+	if _, err = Rebalance(before, NewRing(RingOptions{Seed: 1}).Snapshot()); err != ErrIncompatibleRings {
+		t.Fatalf("Rebalance() with another seed = %v, want %v", err, ErrIncompatibleRings)
+	}
+}
+
+func TestRebalanceFromEmpty(t *testing.T) {
+	r := NewRing(RingOptions{VirtualNodes: 10})
+	before := r.Snapshot()
+	r.AddNode("node-0")
+	moves, _ := Rebalance(before, r.Snapshot())
+	if len(moves) != 1 || moves[0].Start != moves[0].End || moves[0].From != "" || moves[0].To != "node-0" {
+		t.Fatalf("Rebalance() from an empty ring = %v, want the whole ring to node-0", moves)
+	}
+	checkMoves(t, before, r.Snapshot(), moves)
+}
@@ -0,0 +1,143 @@
+package chash
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"dutil/pkg/murmur3"
+)
+
+// RendezvousCHash is highest random weight hashing: every node scores the
+// key by a murmur3 hash of the key and the node name, scaled by the node's
+// weight, and the best scoring nodes own it. Adding or removing a node only
+// moves the keys it wins or won. Lookups cost O(n), which suits clusters of
+// tens of nodes.
+//
+// A RendezvousCHash is safe for concurrent use.
+type RendezvousCHash struct {
+	mu    sync.RWMutex
+	seed  uint32
+	nodes []string
+	// weight per node
+	weights map[string]int
+}
+
+var _ CHash = (*RendezvousCHash)(nil)
+
+// NewRendezvousCHash returns an empty rendezvous hash, keys and nodes are
+// hashed by murmur3 with seed.
+func NewRendezvousCHash(seed uint32) *RendezvousCHash {
+	return &RendezvousCHash{seed: seed, weights: make(map[string]int)}
+}
+
+// AddNode adds node with a weight of 1.
+func (r *RendezvousCHash) AddNode(node string) error { return r.AddWeightedNode(node, 1) }
+
+// AddWeightedNode adds node, it wins weight times as many keys as a node of
+// weight 1.
+func (r *RendezvousCHash) AddWeightedNode(node string, weight int) error {
+	if weight <= 0 {
+		return ErrInvalidWeight
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.weights[node]; ok {
+		return ErrDuplicateNode
+	}
+	r.weights[node] = weight
+	r.nodes = append(r.nodes, node)
+	return nil
+}
+
+// SetWeight changes the weight of node, keys only move to or away from it.
+func (r *RendezvousCHash) SetWeight(node string, weight int) error {
+	if weight <= 0 {
+		return ErrInvalidWeight
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.weights[node]; !ok {
+		return ErrNodeNotFound
+	}
+	r.weights[node] = weight
+	return nil
+}
+
+func (r *RendezvousCHash) RemoveNode(node string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.weights[node]; !ok {
+		return ErrNodeNotFound
+	}
+	delete(r.weights, node)
+	for i, n := range r.nodes {
+		if n == node {
+			r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// score returns the weighted score of node for key, buf is scratch space.
+func (r *RendezvousCHash) score(buf, key []byte, node string) (float64, []byte) {
+	buf = append(append(append(buf[:0], key...), 0), node...)
+	h := murmur3.Sum64WithSeed(buf, r.seed)
+
+	// Map the hash onto (0, 1) and weight it the logarithmic way, so a node
+	// of weight w wins w/W of the keys.
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return float64(r.weights[node]) / -math.Log(u), buf
+}
+
+// GetNode returns the node owning key, or an empty string without nodes.
+func (r *RendezvousCHash) GetNode(key []byte) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var best string
+	var bestScore, score float64
+	var buf []byte
+	for _, node := range r.nodes {
+		if score, buf = r.score(buf, key, node); best == "" || score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// GetNodes returns the n nodes scoring best for key, best first, as
+// replicas of key. Fewer are returned when there are not as many nodes.
+func (r *RendezvousCHash) GetNodes(key []byte, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.nodes) == 0 || n <= 0 {
+		return nil
+	}
+	type scored struct {
+		node  string
+		score float64
+	}
+	var buf []byte
+	all := make([]scored, len(r.nodes))
+	for i, node := range r.nodes {
+		all[i].node = node
+		all[i].score, buf = r.score(buf, key, node)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].score > all[j].score })
+
+	if n > len(all) {
+		n = len(all)
+	}
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = all[i].node
+	}
+	return nodes
+}
+
+func (r *RendezvousCHash) GetNodeNum() uint32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return uint32(len(r.nodes))
+}
@@ -0,0 +1,50 @@
+package chash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRendezvous(t *testing.T) {
+	r := NewRendezvousCHash(0)
+	for i := 0; i < 5; i++ {
+		r.AddNode("node-" + strconv.Itoa(i))
+	}
+	r.SetWeight("node-0", 3)
+
+	const keys = 20000
+	owners := make(map[string]string)
+	load := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = r.GetNode([]byte(key))
+		load[owners[key]]++
+
+		replicas := r.GetNodes([]byte(key), 3)
+		if len(replicas) != 3 || replicas[0] != owners[key] {
+			t.Fatalf("GetNodes(%s) = %v, want 3 nodes led by %s", key, replicas, owners[key])
+		}
+	}
+	// node-0 has 3 of the total weight of 7.
+	if share := float64(load["node-0"]) / keys; share < 0.38 || share > 0.48 {
+		t.Fatalf("node of weight 3 owns %.2f of the keys, want about 0.43", share)
+	}
+
+	if err := r.RemoveNode("node-3"); err != nil {
+		t.Fatal(err)
+	}
+	for key, owner := range owners {
+		node := r.GetNode([]byte(key))
+		if owner != "node-3" && node != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+	}
+	if n := len(r.GetNodes([]byte("key"), 10)); n != 4 {
+		t.Fatalf("GetNodes() returned %d nodes, want 4", n)
+	}
+	for _, n := range []int{0, -1} {
+		if nodes := r.GetNodes([]byte("key"), n); nodes != nil {
+			t.Fatalf("GetNodes(%d) = %v, want nil", n, nodes)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package chash
+
+var (
+	_ ReplicaCHash = (*Ring)(nil)
+	_ ReplicaCHash = (*RendezvousCHash)(nil)
+)
+
+// SetZone labels node with the failure domain it lives in, such as a zone
+// or a rack. An empty zone removes the label.
+func (r *Ring) SetZone(node, zone string) error {
+	return r.update(func(s *RingSnapshot) error {
+		n, ok := s.nodes[node]
+		if !ok {
+			return ErrNodeNotFound
+		}
+		n.Zone = zone
+		s.nodes[node] = n
+		return nil
+	})
+}
+
+// Zone returns the zone label of node.
+func (r *Ring) Zone(node string) string { return r.Snapshot().Zone(node) }
+
+// GetNodes returns up to n distinct nodes for key, see RingSnapshot.GetNodes.
+func (r *Ring) GetNodes(key []byte, n int) []string { return r.Snapshot().GetNodes(key, n) }
+
+// Zone returns the zone label of node.
+func (s *RingSnapshot) Zone(node string) string { return s.nodes[node].Zone }
+
+// GetNodes returns up to n distinct nodes for key, walking the ring from
+// the key on and skipping the virtual nodes of the nodes already picked and
+// of nodes that are down. With DistinctZones it also skips nodes of a zone
+// already picked, a node without zone label being a zone of its own. Fewer
+// nodes are returned when there are not as many nodes or zones.
+func (s *RingSnapshot) GetNodes(key []byte, n int) []string {
+	if len(s.tokens) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(s.nodes) {
+		n = len(s.nodes)
+	}
+
+	nodes := make([]string, 0, n)
+	picked := make(map[string]bool, n)
+	zones := make(map[string]bool, n)
+	start := s.search(s.opts.Hash.Sum32(key))
+	for i := 0; i < len(s.tokens) && len(nodes) < n; i++ {
+		node := s.tokens[(start+i)%len(s.tokens)].node
+		if picked[node] {
+			continue
+		}
+		picked[node] = true
+		if s.nodes[node].State == NodeDown {
+			continue
+		}
+		if s.opts.DistinctZones {
+			if zone := s.nodes[node].Zone; zone != "" {
+				if zones[zone] {
+					continue
+				}
+				zones[zone] = true
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
@@ -0,0 +1,58 @@
+package chash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRingGetNodes(t *testing.T) {
+	r := NewRing(RingOptions{})
+	for i := 0; i < 5; i++ {
+		r.AddNode("node-" + strconv.Itoa(i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(strconv.Itoa(i))
+		nodes := r.GetNodes(key, 3)
+		if len(nodes) != 3 || nodes[0] != r.GetNode(key) {
+			t.Fatalf("GetNodes(%s) = %v, want 3 nodes led by %s", key, nodes, r.GetNode(key))
+		}
+		if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+			t.Fatalf("GetNodes(%s) = %v, want distinct nodes", key, nodes)
+		}
+	}
+	if n := len(r.GetNodes([]byte("key"), 10)); n != 5 {
+		t.Fatalf("GetNodes() returned %d nodes, want 5", n)
+	}
+}
+
+func TestRingGetNodesDistinctZones(t *testing.T) {
+	r := NewRing(RingOptions{DistinctZones: true})
+	zones := map[string]string{
+		"a1": "zone-a", "a2": "zone-a", "a3": "zone-a",
+		"b1": "zone-b", "b2": "zone-b",
+		"c1": "zone-c",
+	}
+	for node, zone := range zones {
+		r.AddNode(node)
+		r.SetZone(node, zone)
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(strconv.Itoa(i))
+		nodes := r.GetNodes(key, 3)
+		if len(nodes) != 3 {
+			t.Fatalf("GetNodes(%s) = %v, want 3 nodes", key, nodes)
+		}
+		seen := make(map[string]bool)
+		for _, node := range nodes {
+			if seen[r.Zone(node)] {
+				t.Fatalf("GetNodes(%s) = %v, two replicas in %s", key, nodes, r.Zone(node))
+			}
+			seen[r.Zone(node)] = true
+		}
+	}
+	if n := len(r.GetNodes([]byte("key"), 4)); n != 3 {
+		t.Fatalf("GetNodes() returned %d nodes from 3 zones", n)
+	}
+}
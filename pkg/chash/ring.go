@@ -0,0 +1,302 @@
+package chash
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultVirtualNodes is the number of points a node owns on a Ring when
+// RingOptions leaves it unset.
+const DefaultVirtualNodes = 160
+
+// RingOptions configures a Ring.
+type RingOptions struct {
+	// VirtualNodes is the number of points every node owns on the ring,
+	// more of them spread the keys more evenly.
+	VirtualNodes int
+
+	// Seed of the murmur3 hash used for tokens and keys when Hash is
+	// unset.
+	Seed uint32
+
+	// Hash places tokens and keys on the ring, Murmur3(Seed) by default.
+	Hash Hash
+
+	// LoadFactor is the ε of consistent hashing with bounded loads, Acquire
+	// lets no node take more than (1+ε) times its share of the total load.
+	LoadFactor float64
+
+	// DistinctZones makes GetNodes pick every node from another zone, see
+	// SetZone.
+	DistinctZones bool
+}
+
+// token is the index-th point of node on the ring.
+type token struct {
+	hash  uint32
+	node  string
+	index int
+}
+
+// Ring is a consistent hash ring with virtual nodes. Each node owns
+// VirtualNodes points per unit of weight on a 32 bit ring and a key belongs
+// to the node owning the first point at or after the key's hash, wrapping
+// around at the end. Adding or removing a node only moves the keys of the
+// ranges it owns.
+//
+// A Ring is safe for concurrent use. Lookups go to an immutable
+// RingSnapshot without locking, membership changes are serialized and
+// swap in a new snapshot.
+type Ring struct {
+	opts     RingOptions
+	mu       sync.Mutex   // serializes membership changes
+	snapshot atomic.Value // *RingSnapshot
+
+	// Bounded load bookkeeping of Acquire and Release.
+	loadMu    sync.Mutex
+	loads     map[string]int64
+	totalLoad int64
+}
+
+var _ CHash = (*Ring)(nil)
+
+// NewRing returns an empty ring.
+func NewRing(opts RingOptions) *Ring {
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = DefaultVirtualNodes
+	}
+	if opts.Hash.sum == nil {
+		opts.Hash = Murmur3(opts.Seed)
+	}
+	r := &Ring{
+		opts:  opts,
+		loads: make(map[string]int64),
+	}
+	r.snapshot.Store(&RingSnapshot{
+		opts:  opts,
+		nodes: make(map[string]Node),
+	})
+	return r
+}
+
+// Snapshot returns the current state of the ring. It is not affected by
+// later membership changes.
+func (r *Ring) Snapshot() *RingSnapshot { return r.snapshot.Load().(*RingSnapshot) }
+
+// update applies fn to a copy of the current snapshot and swaps it in,
+// unless fn fails.
+func (r *Ring) update(fn func(s *RingSnapshot) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.Snapshot().clone()
+	if err := fn(s); err != nil {
+		return err
+	}
+	s.version++
+	r.snapshot.Store(s)
+	return nil
+}
+
+// AddNode puts the virtual nodes of node on the ring, with a weight of 1.
+func (r *Ring) AddNode(node string) error { return r.AddWeightedNode(node, 1) }
+
+// AddWeightedNode puts the virtual nodes of node on the ring, weight times
+// as many as for a node of weight 1.
+func (r *Ring) AddWeightedNode(node string, weight int) error {
+	if weight <= 0 {
+		return ErrInvalidWeight
+	}
+	return r.Add(Node{Name: node, Weight: weight})
+}
+
+// Add puts the virtual nodes of n on the ring, along with its metadata.
+func (r *Ring) Add(n Node) error {
+	if err := n.validate(); err != nil {
+		return err
+	}
+	n = n.clone()
+	return r.update(func(s *RingSnapshot) error {
+		if _, ok := s.nodes[n.Name]; ok {
+			return ErrDuplicateNode
+		}
+		s.nodes[n.Name] = n
+		if n.State == NodeActive {
+			s.totalWeight += n.Weight
+		}
+		s.addTokens(n.Name, 0, n.Weight*s.opts.VirtualNodes)
+		return nil
+	})
+}
+
+// SetWeight changes the weight of node. Only the virtual nodes beyond the
+// smaller of the two weights are added or removed, so keys only move to or
+// away from node.
+func (r *Ring) SetWeight(node string, weight int) error {
+	if weight <= 0 {
+		return ErrInvalidWeight
+	}
+	return r.update(func(s *RingSnapshot) error {
+		n, ok := s.nodes[node]
+		if !ok {
+			return ErrNodeNotFound
+		}
+		old := n.Weight
+		n.Weight = weight
+		s.nodes[node] = n
+		if n.State == NodeActive {
+			s.totalWeight += weight - old
+		}
+		if weight > old {
+			s.addTokens(node, old*s.opts.VirtualNodes, weight*s.opts.VirtualNodes)
+		} else {
+			s.removeTokens(node, weight*s.opts.VirtualNodes)
+		}
+		return nil
+	})
+}
+
+// RemoveNode takes the virtual nodes of node off the ring.
+func (r *Ring) RemoveNode(node string) error {
+	// Hold off Acquire until the node and its load are gone together.
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	err := r.update(func(s *RingSnapshot) error {
+		n, ok := s.nodes[node]
+		if !ok {
+			return ErrNodeNotFound
+		}
+		delete(s.nodes, node)
+		if n.State == NodeActive {
+			s.totalWeight -= n.Weight
+		}
+		s.removeTokens(node, 0)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.totalLoad -= r.loads[node]
+	delete(r.loads, node)
+	return nil
+}
+
+// Weight returns the weight of node, 0 if it is not on the ring.
+func (r *Ring) Weight(node string) int { return r.Snapshot().Weight(node) }
+
+// GetNode returns the node owning key, or an empty string when no node is
+// up.
+func (r *Ring) GetNode(key []byte) string { return r.Snapshot().GetNode(key) }
+
+// GetNodeNum returns the number of nodes on the ring.
+func (r *Ring) GetNodeNum() uint32 { return r.Snapshot().GetNodeNum() }
+
+// RingSnapshot is an immutable state of a Ring. Its version counts the
+// membership changes the ring went through.
+type RingSnapshot struct {
+	version     uint64
+	opts        RingOptions
+	nodes       map[string]Node
+	totalWeight int     // of the active nodes
+	tokens      []token // sorted by hash
+}
+
+// clone returns a deep copy of s to be changed and swapped in.
+func (s *RingSnapshot) clone() *RingSnapshot {
+	c := &RingSnapshot{
+		version:     s.version,
+		opts:        s.opts,
+		nodes:       make(map[string]Node, len(s.nodes)),
+		totalWeight: s.totalWeight,
+		tokens:      make([]token, len(s.tokens)),
+	}
+	// Nodes are copied on the way in and out, their tags are never changed
+	// in place.
+	for name, n := range s.nodes {
+		c.nodes[name] = n
+	}
+	copy(c.tokens, s.tokens)
+	return c
+}
+
+// tokenHash returns the hash of the i-th virtual node of node.
+func (s *RingSnapshot) tokenHash(node string, i int) uint32 {
+	buf := make([]byte, 0, len(node)+8)
+	buf = append(buf, node...)
+	buf = append(buf, '#')
+	buf = strconv.AppendInt(buf, int64(i), 10)
+	return s.opts.Hash.Sum32(buf)
+}
+
+// addTokens puts the virtual nodes from index from up to to of node on the
+// ring.
+func (s *RingSnapshot) addTokens(node string, from, to int) {
+	for i := from; i < to; i++ {
+		s.tokens = append(s.tokens, token{hash: s.tokenHash(node, i), node: node, index: i})
+	}
+	sortTokens(s.tokens)
+}
+
+// removeTokens takes the virtual nodes of node from index from on off the
+// ring.
+func (s *RingSnapshot) removeTokens(node string, from int) {
+	tokens := s.tokens[:0]
+	for _, t := range s.tokens {
+		if t.node != node || t.index < from {
+			tokens = append(tokens, t)
+		}
+	}
+	s.tokens = tokens
+}
+
+// Weight returns the weight of node, 0 if it is not on the ring.
+func (s *RingSnapshot) Weight(node string) int { return s.nodes[node].Weight }
+
+// GetNode returns the node owning key, or an empty string when no node is
+// up.
+func (s *RingSnapshot) GetNode(key []byte) string { return s.owner(s.opts.Hash.Sum32(key)) }
+
+// owner returns the node of the first token at or after hash h whose node
+// is not down, or an empty string when no node is up.
+func (s *RingSnapshot) owner(h uint32) string {
+	if len(s.tokens) == 0 {
+		return ""
+	}
+	start := s.search(h)
+	for i := 0; i < len(s.tokens); i++ {
+		t := s.tokens[(start+i)%len(s.tokens)]
+		if s.nodes[t.node].State != NodeDown {
+			return t.node
+		}
+	}
+	return ""
+}
+
+// search returns the index of the first token at or after hash.
+func (s *RingSnapshot) search(hash uint32) int {
+	i := sort.Search(len(s.tokens), func(i int) bool { return s.tokens[i].hash >= hash })
+	if i == len(s.tokens) {
+		i = 0
+	}
+	return i
+}
+
+// GetNodeNum returns the number of nodes on the ring.
+func (s *RingSnapshot) GetNodeNum() uint32 { return uint32(len(s.nodes)) }
+
+// sortTokens orders tokens by hash, colliding hashes by node so that every
+// ring built from the same nodes agrees on their owner.
+func sortTokens(tokens []token) {
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].hash != tokens[j].hash {
+			return tokens[i].hash < tokens[j].hash
+		}
+		if tokens[i].node != tokens[j].node {
+			return tokens[i].node < tokens[j].node
+		}
+		return tokens[i].index < tokens[j].index
+	})
+}
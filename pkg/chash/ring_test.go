@@ -0,0 +1,141 @@
+package chash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRingGetNode(t *testing.T) {
+	r := NewRing(RingOptions{})
+	if node := r.GetNode([]byte("key")); node != "" {
+		t.Fatalf("GetNode() on empty ring = %q, want empty", node)
+	}
+
+	nodes := []string{"127.0.0.1:8000", "127.0.0.2:8000", "127.0.0.3:8000", "127.0.0.4:8000"}
+	for _, node := range nodes {
+		if err := r.AddNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.AddNode(nodes[0]); err != ErrDuplicateNode {
+		t.Fatalf("AddNode() duplicate = %v, want %v", err, ErrDuplicateNode)
+	}
+	if n := r.GetNodeNum(); n != uint32(len(nodes)) {
+		t.Fatalf("GetNodeNum() = %d, want %d", n, len(nodes))
+	}
+
+	const keys = 10000
+	load := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		load[r.GetNode([]byte(strconv.Itoa(i)))]++
+	}
+	for _, node := range nodes {
+		if share := float64(load[node]) / keys; share < 0.15 || share > 0.35 {
+			t.Errorf("node %s owns %.2f of the keys", node, share)
+		}
+	}
+}
+
+func TestRingRemoveNodeKeepsKeys(t *testing.T) {
+	r := NewRing(RingOptions{VirtualNodes: 100})
+	for i := 0; i < 5; i++ {
+		r.AddNode("node-" + strconv.Itoa(i))
+	}
+
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = r.GetNode([]byte(key))
+	}
+
+	if err := r.RemoveNode("node-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RemoveNode("node-2"); err != ErrNodeNotFound {
+		t.Fatalf("RemoveNode() twice = %v, want %v", err, ErrNodeNotFound)
+	}
+	for key, owner := range before {
+		node := r.GetNode([]byte(key))
+		if owner != "node-2" && node != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+		if node == "node-2" {
+			t.Fatalf("key %s still on removed node", key)
+		}
+	}
+}
+
+func TestRingWeight(t *testing.T) {
+	r := NewRing(RingOptions{})
+	r.AddWeightedNode("small", 1)
+	r.AddWeightedNode("large", 3)
+	if err := r.AddWeightedNode("none", 0); err != ErrInvalidWeight {
+		t.Fatalf("AddWeightedNode() with zero weight = %v, want %v", err, ErrInvalidWeight)
+	}
+
+	const keys = 20000
+	owners := make(map[string]string)
+	load := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = r.GetNode([]byte(key))
+		load[owners[key]]++
+	}
+	if share := float64(load["large"]) / keys; share < 0.65 || share > 0.85 {
+		t.Fatalf("node of weight 3 owns %.2f of the keys, want about 0.75", share)
+	}
+
+	// Growing a node only moves keys onto it.
+	if err := r.SetWeight("small", 3); err != nil {
+		t.Fatal(err)
+	}
+	if w := r.Weight("small"); w != 3 {
+		t.Fatalf("Weight() = %d, want 3", w)
+	}
+	for key, owner := range owners {
+		if node := r.GetNode([]byte(key)); node != owner && node != "small" {
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+	}
+
+	// Shrinking it back restores the original placement.
+	r.SetWeight("small", 1)
+	for key, owner := range owners {
+		if node := r.GetNode([]byte(key)); node != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, node)
+		}
+	}
+}
+
+func TestRingConcurrentUpdates(t *testing.T) {
+	r := NewRing(RingOptions{VirtualNodes: 20})
+	r.AddNode("stable")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			node := "node-" + strconv.Itoa(i%5)
+			r.AddNode(node)
+			r.SetZone(node, "zone")
+			r.RemoveNode(node)
+		}
+	}()
+
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		key := []byte(strconv.Itoa(i))
+		if node := r.GetNode(key); node == "" {
+			t.Fatal("GetNode() = empty while a node is always on the ring")
+		}
+		if node, err := r.Acquire(key); err != nil {
+			t.Fatal(err)
+		} else {
+			r.Release(node)
+		}
+	}
+}
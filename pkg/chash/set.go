@@ -1,9 +1,6 @@
 package chash
 
-import (
-	"errors"
-	"fmt"
-)
+import "sync"
 
 type Set interface {
 	Get(i uint32) string
@@ -12,35 +9,109 @@ type Set interface {
 	Len() uint32
 }
 
+// NodeSet is a Set safe for concurrent use, nodes keep the order they were
+// added in. It keeps the metadata of every node along.
 type NodeSet struct {
+	mu       sync.RWMutex
 	nodeList []string
 	nodeMap  map[string]uint32
 	nodeNum  uint32
+	meta     map[string]Node
+}
+
+func NewNodeSet() *NodeSet {
+	return &NodeSet{nodeMap: make(map[string]uint32), meta: make(map[string]Node)}
 }
 
 func (n *NodeSet) Get(i uint32) string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
 	return n.nodeList[i]
 }
 
-func (n *NodeSet) Add(node string) error {
-	if _, ok := n.nodeMap[node]; ok {
-		return errors.New("duplicate register node")
+func (n *NodeSet) Add(node string) error { return n.AddNode(Node{Name: node}) }
+
+// AddNode adds node along with its metadata.
+func (n *NodeSet) AddNode(node Node) error {
+	if err := node.validate(); err != nil {
+		return err
 	}
-	n.nodeList = append(n.nodeList, node)
-	n.nodeMap[node] = n.nodeNum
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.nodeMap[node.Name]; ok {
+		return ErrDuplicateNode
+	}
+	n.nodeList = append(n.nodeList, node.Name)
+	n.nodeMap[node.Name] = n.nodeNum
+	n.meta[node.Name] = node.clone()
 	n.nodeNum += 1
 	return nil
 }
 
+// Node returns node with its metadata.
+func (n *NodeSet) Node(node string) (Node, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	m, ok := n.meta[node]
+	if !ok {
+		return Node{}, false
+	}
+	return m.clone(), true
+}
+
+// down reports whether node is in the set and down.
+func (n *NodeSet) down(node string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.meta[node].State == NodeDown
+}
+
+// SetState moves node into state.
+func (n *NodeSet) SetState(node string, state NodeState) error {
+	if state < NodeActive || state > NodeDown {
+		return ErrInvalidState
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	m, ok := n.meta[node]
+	if !ok {
+		return ErrNodeNotFound
+	}
+	m.State = state
+	n.meta[node] = m
+	return nil
+}
+
+// Remove removes node, the nodes after it move up one index.
 func (n *NodeSet) Remove(node string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	index, ok := n.nodeMap[node]
 	if !ok {
-		return errors.New(fmt.Sprintf("node: < %s > does not exist", node))
+		return ErrNodeNotFound
+	}
+	// Copy instead of shifting in place, slices handed out by Nodes stay
+	// untouched.
+	nodeList := make([]string, 0, len(n.nodeList)-1)
+	n.nodeList = append(append(nodeList, n.nodeList[:index]...), n.nodeList[index+1:]...)
+	delete(n.nodeMap, node)
+	delete(n.meta, node)
+	for i := index; i < uint32(len(n.nodeList)); i++ {
+		n.nodeMap[n.nodeList[i]] = i
 	}
-	n.nodeList = append(n.nodeList[:index], n.nodeList[index+1:]...)
+	n.nodeNum -= 1
 	return nil
 }
 
+// Nodes returns all nodes in order, the slice must not be modified.
+func (n *NodeSet) Nodes() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.nodeList[:len(n.nodeList):len(n.nodeList)]
+}
+
 func (n *NodeSet) Len() uint32 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
 	return n.nodeNum
 }
@@ -0,0 +1,36 @@
+package chash
+
+import "testing"
+
+func TestNodeSetRemove(t *testing.T) {
+	s := NewNodeSet()
+	for _, node := range []string{"a", "b", "c", "d"} {
+		s.Add(node)
+	}
+	nodes := s.Nodes()
+
+	if err := s.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove("b"); err != ErrNodeNotFound {
+		t.Fatalf("Remove() of a removed node = %v, want %v", err, ErrNodeNotFound)
+	}
+	if err := s.Add("a"); err != ErrDuplicateNode {
+		t.Fatalf("Add() of a known node = %v, want %v", err, ErrDuplicateNode)
+	}
+	if s.Len() != 3 || s.Get(0) != "a" || s.Get(1) != "c" || s.Get(2) != "d" {
+		t.Fatalf("set after Remove() = %v, want [a c d]", s.Nodes())
+	}
+	if nodes[1] != "b" {
+		t.Fatalf("Remove() changed an earlier Nodes() result: %v", nodes)
+	}
+
+	// The indices of the nodes after the removed one moved up.
+	if err := s.Remove("d"); err != nil {
+		t.Fatal(err)
+	}
+	s.Add("e")
+	if s.Len() != 3 || s.Get(2) != "e" {
+		t.Fatalf("set = %v, want [a c e]", s.Nodes())
+	}
+}
@@ -0,0 +1,351 @@
+package chash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"dutil/pkg/murmur3"
+)
+
+var (
+	ErrStaleRing       = errors.New("ring version is older than the current one")
+	ErrChecksum        = errors.New("ring checksum mismatch")
+	ErrInvalidSnapshot = errors.New("invalid ring snapshot")
+)
+
+// binaryMagic starts every binary encoded RingSnapshot, the last byte is
+// the format version.
+var binaryMagic = [4]byte{'c', 'h', 'r', 3}
+
+// NewRingFromSnapshot returns a ring starting out as s, with the virtual
+// nodes of s and the other options from opts. It takes the Hash of s
+// unless opts has one.
+func NewRingFromSnapshot(s *RingSnapshot, opts RingOptions) (*Ring, error) {
+	if opts.Hash.sum == nil {
+		opts.Hash = s.opts.Hash
+	}
+	r := NewRing(opts)
+	if err := r.Replace(s); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Replace swaps in s as the state of r, as fetched from the ring's owner.
+// It refuses a snapshot of an older version than the current one, and one
+// made with another Hash.
+func (r *Ring) Replace(s *RingSnapshot) error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !s.opts.Hash.same(r.opts.Hash) {
+		return ErrIncompatibleRings
+	}
+	if s.version < r.Snapshot().version {
+		return ErrStaleRing
+	}
+	c := s.clone()
+	r.opts.VirtualNodes = s.opts.VirtualNodes
+	c.opts = r.opts
+	r.snapshot.Store(c)
+
+	for node, load := range r.loads {
+		if _, ok := c.nodes[node]; !ok {
+			r.totalLoad -= load
+			delete(r.loads, node)
+		}
+	}
+	return nil
+}
+
+// Version returns the number of membership changes the ring went through.
+func (s *RingSnapshot) Version() uint64 { return s.version }
+
+// Checksum returns a hash of everything deciding the placement of keys:
+// the Hash, nodes and their metadata and tokens. Two snapshots with the same
+// checksum place every key alike, regardless of their versions.
+func (s *RingSnapshot) Checksum() uint64 {
+	return murmur3.Sum64(s.appendBody(nil))
+}
+
+// sortedNodes returns the node names in order.
+func (s *RingSnapshot) sortedNodes() []string {
+	nodes := make([]string, 0, len(s.nodes))
+	for node := range s.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// appendBody appends the canonical encoding of s, without its version, to
+// buf.
+func (s *RingSnapshot) appendBody(buf []byte) []byte {
+	nodes := s.sortedNodes()
+	index := make(map[string]uint32, len(nodes))
+
+	buf = appendString(buf, s.opts.Hash.name)
+	buf = appendUint32(buf, s.opts.Hash.fingerprint)
+	buf = appendUint32(buf, uint32(s.opts.VirtualNodes))
+	buf = appendUint32(buf, uint32(len(nodes)))
+	for i, node := range nodes {
+		index[node] = uint32(i)
+		n := s.nodes[node]
+		buf = appendString(buf, node)
+		buf = appendUint32(buf, uint32(n.Weight))
+		buf = appendString(buf, n.Zone)
+		buf = appendString(buf, n.Addr)
+		buf = appendUint32(buf, uint32(n.State))
+		tags := make([]string, 0, len(n.Tags))
+		for k := range n.Tags {
+			tags = append(tags, k)
+		}
+		sort.Strings(tags)
+		buf = appendUint32(buf, uint32(len(tags)))
+		for _, k := range tags {
+			buf = appendString(appendString(buf, k), n.Tags[k])
+		}
+	}
+	buf = appendUint32(buf, uint32(len(s.tokens)))
+	for _, t := range s.tokens {
+		buf = appendUint32(buf, t.hash)
+		buf = appendUint32(buf, index[t.node])
+		buf = appendUint32(buf, uint32(t.index))
+	}
+	return buf
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
+
+func appendString(buf []byte, v string) []byte {
+	var n [binary.MaxVarintLen64]byte
+	buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(v)))]...)
+	return append(buf, v...)
+}
+
+// MarshalBinary encodes s as magic, version, the canonical body and its
+// checksum.
+func (s *RingSnapshot) MarshalBinary() ([]byte, error) {
+	buf := append([]byte(nil), binaryMagic[:]...)
+	buf = appendUint64(buf, s.version)
+	body := len(buf)
+	buf = s.appendBody(buf)
+	return appendUint64(buf, murmur3.Sum64(buf[body:])), nil
+}
+
+// UnmarshalBinary decodes a snapshot encoded by MarshalBinary into s. It
+// fails with ErrUnknownHash for a snapshot made with a hash not known here.
+func (s *RingSnapshot) UnmarshalBinary(data []byte) error {
+	if len(data) < len(binaryMagic)+16 || !bytes.Equal(data[:len(binaryMagic)], binaryMagic[:]) {
+		return ErrInvalidSnapshot
+	}
+	version := binary.BigEndian.Uint64(data[len(binaryMagic):])
+	body := data[len(binaryMagic)+8 : len(data)-8]
+	if murmur3.Sum64(body) != binary.BigEndian.Uint64(data[len(data)-8:]) {
+		return ErrChecksum
+	}
+
+	d := decoder{buf: body}
+	hash, fingerprint, vnodes := d.string(), d.uint32(), d.uint32()
+	// A node takes at least three empty strings and three uint32s, a token
+	// three uint32s.
+	nodes := make([]snapshotNode, d.count(15))
+	for i := range nodes {
+		nodes[i].Name = d.string()
+		nodes[i].Weight = int(d.uint32())
+		nodes[i].Zone = d.string()
+		nodes[i].Addr = d.string()
+		nodes[i].State = NodeState(d.uint32())
+		if tags := d.uint32(); tags > 0 && d.err == nil {
+			nodes[i].Tags = make(map[string]string)
+			for j := uint32(0); j < tags && d.err == nil; j++ {
+				k := d.string()
+				nodes[i].Tags[k] = d.string()
+			}
+		}
+	}
+	tokens := make([]snapshotToken, d.count(12))
+	for i := range tokens {
+		tokens[i].Hash = d.uint32()
+		node := d.uint32()
+		if int(node) >= len(nodes) {
+			return ErrInvalidSnapshot
+		}
+		tokens[i].Node = nodes[node].Name
+		tokens[i].Index = int(d.uint32())
+	}
+	if d.err != nil || len(d.buf) != 0 {
+		return ErrInvalidSnapshot
+	}
+	return s.load(&snapshotData{
+		Version:         version,
+		Hash:            hash,
+		HashFingerprint: fingerprint,
+		VirtualNodes:    int(vnodes),
+		Nodes:           nodes,
+		Tokens:          tokens,
+	})
+}
+
+// decoder reads the fields appended by appendBody, it stops at the first
+// error.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uint32() uint32 {
+	if d.err != nil || len(d.buf) < 4 {
+		d.err = ErrInvalidSnapshot
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	return v
+}
+
+// count reads the number of the entries that follow, each taking at least
+// size bytes, so that no count claims more entries than the buffer holds.
+func (d *decoder) count(size int) int {
+	n := d.uint32()
+	if uint64(n)*uint64(size) > uint64(len(d.buf)) {
+		d.err = ErrInvalidSnapshot
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n, size := binary.Uvarint(d.buf)
+	if d.err != nil || size <= 0 || uint64(len(d.buf)-size) < n {
+		d.err = ErrInvalidSnapshot
+		return ""
+	}
+	v := string(d.buf[size : size+int(n)])
+	d.buf = d.buf[size+int(n):]
+	return v
+}
+
+// snapshotData is the decoded form of a RingSnapshot, and its JSON encoding.
+type snapshotData struct {
+	Version         uint64          `json:"version"`
+	Checksum        uint64          `json:"checksum,string"`
+	Hash            string          `json:"hash"`
+	HashFingerprint uint32          `json:"hash_fingerprint"`
+	VirtualNodes    int             `json:"virtual_nodes"`
+	Nodes           []snapshotNode  `json:"nodes"`
+	Tokens          []snapshotToken `json:"tokens"`
+}
+
+type snapshotNode struct {
+	Name   string            `json:"name"`
+	Weight int               `json:"weight"`
+	Zone   string            `json:"zone,omitempty"`
+	Addr   string            `json:"addr,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	State  NodeState         `json:"state"`
+}
+
+type snapshotToken struct {
+	Hash  uint32 `json:"hash"`
+	Node  string `json:"node"`
+	Index int    `json:"index"`
+}
+
+// MarshalJSON encodes s with its checksum.
+func (s *RingSnapshot) MarshalJSON() ([]byte, error) {
+	v := snapshotData{
+		Version:         s.version,
+		Checksum:        s.Checksum(),
+		Hash:            s.opts.Hash.name,
+		HashFingerprint: s.opts.Hash.fingerprint,
+		VirtualNodes:    s.opts.VirtualNodes,
+		Nodes:           make([]snapshotNode, 0, len(s.nodes)),
+		Tokens:          make([]snapshotToken, len(s.tokens)),
+	}
+	for _, node := range s.sortedNodes() {
+		n := s.nodes[node]
+		v.Nodes = append(v.Nodes, snapshotNode{
+			Name:   n.Name,
+			Weight: n.Weight,
+			Zone:   n.Zone,
+			Addr:   n.Addr,
+			Tags:   n.Tags,
+			State:  n.State,
+		})
+	}
+	for i, t := range s.tokens {
+		v.Tokens[i] = snapshotToken{Hash: t.hash, Node: t.node, Index: t.index}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a snapshot encoded by MarshalJSON into s and
+// verifies its checksum. It fails with ErrUnknownHash for a snapshot made
+// with a hash not known here.
+func (s *RingSnapshot) UnmarshalJSON(data []byte) error {
+	var v snapshotData
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := s.load(&v); err != nil {
+		return err
+	}
+	if s.Checksum() != v.Checksum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// load sets s to the decoded snapshot v.
+func (s *RingSnapshot) load(v *snapshotData) error {
+	if v.VirtualNodes <= 0 {
+		return ErrInvalidSnapshot
+	}
+	hash, err := lookupHash(v.Hash, v.HashFingerprint)
+	if err != nil {
+		return err
+	}
+	*s = RingSnapshot{
+		version: v.Version,
+		opts:    RingOptions{VirtualNodes: v.VirtualNodes, Hash: hash},
+		nodes:   make(map[string]Node, len(v.Nodes)),
+		tokens:  make([]token, len(v.Tokens)),
+	}
+	for _, sn := range v.Nodes {
+		n := Node{
+			Name:   sn.Name,
+			Addr:   sn.Addr,
+			Zone:   sn.Zone,
+			Weight: sn.Weight,
+			Tags:   sn.Tags,
+			State:  sn.State,
+		}
+		if _, ok := s.nodes[n.Name]; ok || n.Weight <= 0 || n.validate() != nil {
+			return ErrInvalidSnapshot
+		}
+		s.nodes[n.Name] = n
+		if n.State == NodeActive {
+			s.totalWeight += n.Weight
+		}
+	}
+	for i, t := range v.Tokens {
+		if _, ok := s.nodes[t.Node]; !ok {
+			return ErrInvalidSnapshot
+		}
+		s.tokens[i] = token{hash: t.Hash, node: t.Node, index: t.Index}
+	}
+	sortTokens(s.tokens)
+	return nil
+}
@@ -0,0 +1,113 @@
+package chash
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"dutil/pkg/murmur3"
+)
+
+func testRing() *Ring {
+	r := NewRing(RingOptions{VirtualNodes: 20, Seed: 7})
+	for i := 0; i < 4; i++ {
+		node := "node-" + strconv.Itoa(i)
+		r.AddWeightedNode(node, i+1)
+		r.SetZone(node, "zone-"+strconv.Itoa(i%2))
+	}
+	return r
+}
+
+// checkSameRing verifies that got places keys exactly like want.
+func checkSameRing(t *testing.T, want, got *RingSnapshot) {
+	t.Helper()
+	if got.Version() != want.Version() || got.Checksum() != want.Checksum() {
+		t.Fatalf("got version %d checksum %x, want %d %x",
+			got.Version(), got.Checksum(), want.Version(), want.Checksum())
+	}
+	for i := 0; i < 1000; i++ {
+		key := []byte(strconv.Itoa(i))
+		if g, w := got.GetNode(key), want.GetNode(key); g != w {
+			t.Fatalf("key %s on %s, want %s", key, g, w)
+		}
+	}
+}
+
+func TestSnapshotBinary(t *testing.T) {
+	want := testRing().Snapshot()
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got RingSnapshot
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	checkSameRing(t, want, &got)
+
+	data[len(data)/2] ^= 0xff
+	if err := got.UnmarshalBinary(data); err != ErrChecksum {
+		t.Fatalf("UnmarshalBinary() of corrupted data = %v, want %v", err, ErrChecksum)
+	}
+	if err := got.UnmarshalBinary(data[:10]); err != ErrInvalidSnapshot {
+		t.Fatalf("UnmarshalBinary() of truncated data = %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	// A checksum does not keep counts from claiming more than there is.
+	h := Murmur3(0)
+	for _, body := range [][]byte{
+		appendUint32(appendUint32(appendUint32(appendString(nil, h.name), h.fingerprint), 1), 1<<32-1),
+		appendUint32(appendUint32(appendUint32(appendUint32(appendString(nil, h.name), h.fingerprint), 1), 0), 1<<32-1),
+	} {
+		data := appendUint64(append([]byte(nil), binaryMagic[:]...), 0)
+		data = append(data, body...)
+		data = appendUint64(data, murmur3.Sum64(body))
+		if err := got.UnmarshalBinary(data); err != ErrInvalidSnapshot {
+			t.Fatalf("UnmarshalBinary() of an oversized count = %v, want %v", err, ErrInvalidSnapshot)
+		}
+	}
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	want := testRing().Snapshot()
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got RingSnapshot
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	checkSameRing(t, want, &got)
+	if got.Zone("node-1") != "zone-1" || got.Weight("node-3") != 4 {
+		t.Fatal("zones or weights lost in JSON")
+	}
+}
+
+func TestRingReplace(t *testing.T) {
+	src := testRing()
+	r, err := NewRingFromSnapshot(src.Snapshot(), RingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameRing(t, src.Snapshot(), r.Snapshot())
+
+	stale := src.Snapshot()
+	src.RemoveNode("node-0")
+	if err := r.Replace(src.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	checkSameRing(t, src.Snapshot(), r.Snapshot())
+	if err := r.Replace(stale); err != ErrStaleRing {
+		t.Fatalf("Replace() with an older version = %v, want %v", err, ErrStaleRing)
+	}
+
+	// Rebuilding the same membership elsewhere yields the same checksum.
+	other := testRing()
+	other.RemoveNode("node-0")
+	if other.Snapshot().Checksum() != r.Snapshot().Checksum() {
+		t.Fatal("equal rings have different checksums")
+	}
+}
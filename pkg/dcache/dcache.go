@@ -0,0 +1,333 @@
+// Package dcache is a peer to peer read through cache in the manner of
+// groupcache. Every key is owned by one peer, picked by a consistent hash
+// ring of the peers. The owner loads a missing key and keeps it, the other
+// peers fetch it from the owner over HTTP and mirror it in a small LRU
+// cache, unlike groupcache every fetched key rather than a sample.
+//
+//	c, err := dcache.New("thumbnails", dcache.GetterFunc(render), dcache.Options{
+//		Self: "http://10.0.0.1:8000",
+//	})
+//	c.SetPeers("http://10.0.0.1:8000", "http://10.0.0.2:8000", "http://10.0.0.3:8000")
+//	http.Handle(c.Path(), c)
+//	...
+//	thumb, err := c.Get(ctx, "cat.jpg")
+package dcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"dutil/pkg/chash"
+)
+
+const (
+	// DefaultBasePath prefixes the path peers are reached on, unless
+	// Options say otherwise.
+	DefaultBasePath = "/_dcache/"
+	// DefaultMainCacheSize is the number of owned keys kept by default.
+	DefaultMainCacheSize = 4096
+	// DefaultHotCacheSize is the number of keys of other owners mirrored by
+	// default.
+	DefaultHotCacheSize = 512
+)
+
+var ErrNoSelf = errors.New("dcache: Options.Self must be set")
+
+// A Getter loads the value of a key missing from the cache of its owner.
+type Getter interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// GetterFunc is a Getter function.
+type GetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get calls f.
+func (f GetterFunc) Get(ctx context.Context, key string) ([]byte, error) { return f(ctx, key) }
+
+// Options configures a Cache.
+type Options struct {
+	// Self is the base URL the other peers reach this one on, as it is
+	// named in SetPeers.
+	Self string
+
+	// BasePath is the path the caches of all peers are served under,
+	// DefaultBasePath when empty.
+	BasePath string
+
+	// MainCacheSize is the number of owned keys kept,
+	// DefaultMainCacheSize when zero.
+	MainCacheSize int
+
+	// HotCacheSize is the number of keys of other owners mirrored,
+	// DefaultHotCacheSize when zero. Every key fetched from its owner is
+	// mirrored, the least recently used ones make room.
+	HotCacheSize int
+
+	// Ring configures the consistent hash ring of the peers.
+	Ring chash.RingOptions
+
+	// Client fetches keys from their owners, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// Stats are the counters of a Cache.
+type Stats struct {
+	Gets        int64 // calls to Get
+	Hits        int64 // answered by the main cache
+	HotHits     int64 // answered by the hot cache
+	Coalesced   int64 // misses that waited on a load of the same key
+	Loads       int64 // calls to the Getter
+	PeerLoads   int64 // keys fetched from their owner
+	PeerErrors  int64 // failed fetches, loaded locally instead
+	PeerServed  int64 // requests of other peers served
+	LoadErrors  int64 // failed loads
+	MainEntries int
+	HotEntries  int
+}
+
+// Cache is one named cache of a group of peers, every peer creates it with
+// the same name and serves it to the others.
+//
+// A Cache is safe for concurrent use.
+type Cache struct {
+	name   string
+	getter Getter
+	opts   Options
+	ring   *chash.Ring
+
+	main *lru.Cache // keys owned here
+	hot  *lru.Cache // keys owned by other peers
+
+	// Loads and fetches are coalesced apart, so serving a peer never waits
+	// on a fetch from a peer. Two peers disagreeing on the owner of a key
+	// would wait on each other otherwise.
+	loads, fetches flightGroup
+
+	mu    sync.Mutex // serializes SetPeers
+	stats Stats
+}
+
+var _ http.Handler = (*Cache)(nil)
+
+// New returns the cache name loading missing keys with getter.
+func New(name string, getter Getter, opts Options) (*Cache, error) {
+	if opts.Self == "" {
+		return nil, ErrNoSelf
+	}
+	opts.Self = strings.TrimSuffix(opts.Self, "/")
+	if opts.BasePath == "" {
+		opts.BasePath = DefaultBasePath
+	}
+	if opts.MainCacheSize <= 0 {
+		opts.MainCacheSize = DefaultMainCacheSize
+	}
+	if opts.HotCacheSize <= 0 {
+		opts.HotCacheSize = DefaultHotCacheSize
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	main, err := lru.New(opts.MainCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	hot, err := lru.New(opts.HotCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{
+		name:   name,
+		getter: getter,
+		opts:   opts,
+		ring:   chash.NewRing(opts.Ring),
+		main:   main,
+		hot:    hot,
+	}, nil
+}
+
+// Name returns the name of the cache.
+func (c *Cache) Name() string { return c.name }
+
+// Path returns the path c serves the other peers on, to register c under.
+func (c *Cache) Path() string {
+	return c.opts.BasePath + url.PathEscape(c.name) + "/"
+}
+
+// Ring returns the ring of the peers. It can be kept up to date by a
+// chash.Membership instead of SetPeers, with the peers named by their
+// base URLs.
+func (c *Cache) Ring() *chash.Ring { return c.ring }
+
+// SetPeers replaces the peers by peers, their base URLs. Self has to be
+// among them for c to own any keys.
+func (c *Cache) SetPeers(peers ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keep := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		peer = strings.TrimSuffix(peer, "/")
+		keep[peer] = true
+		c.ring.AddNode(peer) // already there is fine
+	}
+	for _, n := range c.ring.Nodes() {
+		if !keep[n.Name] {
+			c.ring.RemoveNode(n.Name)
+		}
+	}
+}
+
+// Get returns the value of key: from the local caches if there, from its
+// owner otherwise, which loads it if it has to. The value must not be
+// modified.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&c.stats.Gets, 1)
+	if v, ok := c.main.Get(key); ok {
+		atomic.AddInt64(&c.stats.Hits, 1)
+		return v.([]byte), nil
+	}
+	if v, ok := c.hot.Get(key); ok {
+		atomic.AddInt64(&c.stats.HotHits, 1)
+		return v.([]byte), nil
+	}
+
+	owner := c.ring.GetNode([]byte(key))
+	if owner == "" || owner == c.opts.Self {
+		return c.loadLocally(ctx, key)
+	}
+
+	val, err, shared := c.fetches.Do(key, func() ([]byte, error) {
+		val, err := c.fetch(ctx, owner, key)
+		if err == nil {
+			atomic.AddInt64(&c.stats.PeerLoads, 1)
+			c.hot.Add(key, val)
+			return val, nil
+		}
+		if _, ok := err.(*ownerLoadError); ok {
+			// Loading it here would fail alike, at the cost of another
+			// load.
+			return nil, err
+		}
+		// Rather serve the key than fail with the owner.
+		atomic.AddInt64(&c.stats.PeerErrors, 1)
+		return c.load(ctx, key)
+	})
+	if shared {
+		atomic.AddInt64(&c.stats.Coalesced, 1)
+	}
+	return val, err
+}
+
+// loadLocally loads key as its owner and keeps it.
+func (c *Cache) loadLocally(ctx context.Context, key string) ([]byte, error) {
+	val, err, shared := c.loads.Do(key, func() ([]byte, error) {
+		// A load that just finished may have filled it.
+		if v, ok := c.main.Get(key); ok {
+			return v.([]byte), nil
+		}
+		val, err := c.load(ctx, key)
+		if err == nil {
+			c.main.Add(key, val)
+		}
+		return val, err
+	})
+	if shared {
+		atomic.AddInt64(&c.stats.Coalesced, 1)
+	}
+	return val, err
+}
+
+func (c *Cache) load(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&c.stats.Loads, 1)
+	val, err := c.getter.Get(ctx, key)
+	if err != nil {
+		atomic.AddInt64(&c.stats.LoadErrors, 1)
+	}
+	return val, err
+}
+
+// ownerLoadError is the error of the owner of a key failing to load it.
+type ownerLoadError struct{ msg string }
+
+func (e *ownerLoadError) Error() string { return e.msg }
+
+// fetch gets key from the peer owning it. It returns an *ownerLoadError
+// when the owner was reached but failed to load the key.
+func (c *Cache) fetch(ctx context.Context, peer, key string) ([]byte, error) {
+	u := peer + c.Path() + url.PathEscape(key)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.opts.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusInternalServerError:
+		// ServeHTTP answers so for load errors only, see there.
+		return nil, &ownerLoadError{fmt.Sprintf("dcache: %s: %s", u, strings.TrimSpace(string(body)))}
+	default:
+		return nil, fmt.Errorf("dcache: %s: %s: %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// ServeHTTP serves the keys owned here to the other peers. It always loads
+// locally, so peers disagreeing on the owner cannot send a key around in
+// circles.
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.EscapedPath(), c.Path()) {
+		http.NotFound(w, r)
+		return
+	}
+	key, err := url.PathUnescape(r.URL.EscapedPath()[len(c.Path()):])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	atomic.AddInt64(&c.stats.PeerServed, 1)
+
+	val, err := c.loadLocally(r.Context(), key)
+	if err != nil {
+		// The status tells a load error from an unreachable owner.
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(val)
+}
+
+// Stats returns the counters of c.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Gets:        atomic.LoadInt64(&c.stats.Gets),
+		Hits:        atomic.LoadInt64(&c.stats.Hits),
+		HotHits:     atomic.LoadInt64(&c.stats.HotHits),
+		Coalesced:   atomic.LoadInt64(&c.stats.Coalesced),
+		Loads:       atomic.LoadInt64(&c.stats.Loads),
+		PeerLoads:   atomic.LoadInt64(&c.stats.PeerLoads),
+		PeerErrors:  atomic.LoadInt64(&c.stats.PeerErrors),
+		PeerServed:  atomic.LoadInt64(&c.stats.PeerServed),
+		LoadErrors:  atomic.LoadInt64(&c.stats.LoadErrors),
+		MainEntries: c.main.Len(),
+		HotEntries:  c.hot.Len(),
+	}
+}
@@ -0,0 +1,159 @@
+package dcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPeers starts n peers of the cache "test" sharing getter.
+func testPeers(t *testing.T, n int, getter Getter) ([]*Cache, func()) {
+	t.Helper()
+	var servers []*httptest.Server
+	var urls []string
+	var caches []*Cache
+	for i := 0; i < n; i++ {
+		mux := http.NewServeMux()
+		srv := httptest.NewServer(mux)
+		c, err := New("test", getter, Options{Self: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mux.Handle(c.Path(), c)
+		servers = append(servers, srv)
+		urls = append(urls, srv.URL)
+		caches = append(caches, c)
+	}
+	for _, c := range caches {
+		c.SetPeers(urls...)
+	}
+	return caches, func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	var mu sync.Mutex
+	loads := make(map[string]int)
+	getter := GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		mu.Lock()
+		loads[key]++
+		mu.Unlock()
+		if key == "missing" {
+			return nil, errors.New("no such key")
+		}
+		return []byte("value of " + key), nil
+	})
+	caches, stop := testPeers(t, 3, getter)
+	defer stop()
+
+	ctx := context.Background()
+	for i := 0; i < 50; i++ {
+		key := "key/" + strconv.Itoa(i)
+		for _, c := range caches {
+			val, err := c.Get(ctx, key)
+			if err != nil || string(val) != "value of "+key {
+				t.Fatalf("Get(%s) = %q, %v", key, val, err)
+			}
+		}
+	}
+	for key, n := range loads {
+		if n != 1 {
+			t.Fatalf("%s loaded %d times, want once by its owner", key, n)
+		}
+	}
+
+	var stats Stats
+	for _, c := range caches {
+		s := c.Stats()
+		stats.PeerLoads += s.PeerLoads
+		stats.PeerServed += s.PeerServed
+		stats.MainEntries += s.MainEntries
+	}
+	if stats.MainEntries != 50 || stats.PeerLoads != stats.PeerServed || stats.PeerLoads == 0 {
+		t.Fatalf("stats = %+v, want 50 owned keys and as many fetched keys as served", stats)
+	}
+
+	// Second time around every peer answers from its own caches.
+	for _, c := range caches {
+		before := c.Stats()
+		c.Get(ctx, "key/0")
+		after := c.Stats()
+		if after.Hits+after.HotHits != before.Hits+before.HotHits+1 {
+			t.Fatalf("Get() of a fetched key missed the local caches")
+		}
+	}
+
+	for _, c := range caches {
+		if _, err := c.Get(ctx, "missing"); err == nil {
+			t.Fatal("Get() of a key failing to load succeeded")
+		}
+	}
+	// The owner failing to load a key is no reason to load it again.
+	if n := loads["missing"]; n != len(caches) {
+		t.Fatalf("missing key loaded %d times, want once per Get by its owner", n)
+	}
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	getter := GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []byte(key), nil
+	})
+	caches, stop := testPeers(t, 2, getter)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(c *Cache) {
+			defer wg.Done()
+			if val, err := c.Get(context.Background(), "hot"); err != nil || string(val) != "hot" {
+				t.Errorf("Get() = %q, %v", val, err)
+			}
+		}(caches[i%2])
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("getter called %d times for concurrent misses, want 1", calls)
+	}
+}
+
+func TestCacheOwnerDown(t *testing.T) {
+	getter := GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	c, err := New("test", getter, Options{Self: "http://self"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The other peer cannot be reached, so its keys are loaded here.
+	c.SetPeers("http://self", "http://127.0.0.1:1")
+	for i := 0; i < 20; i++ {
+		key := strconv.Itoa(i)
+		if val, err := c.Get(context.Background(), key); err != nil || string(val) != key {
+			t.Fatalf("Get(%s) = %q, %v", key, val, err)
+		}
+	}
+	if s := c.Stats(); s.PeerErrors == 0 || s.Loads != 20 {
+		t.Fatalf("stats = %+v, want failed fetches loaded locally", s)
+	}
+
+	if _, err := New("test", getter, Options{}); err != ErrNoSelf {
+		t.Fatalf("New() without Self = %v, want %v", err, ErrNoSelf)
+	}
+}
@@ -0,0 +1,43 @@
+package dcache
+
+import "sync"
+
+// call is a load in progress or just done.
+type call struct {
+	wg  sync.WaitGroup
+	val []byte
+	err error
+}
+
+// flightGroup coalesces concurrent loads of the same key into one.
+type flightGroup struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// Do runs fn for key, unless it is already running for key, in which case
+// it waits for that run and returns its result. shared tells the callers
+// that got the result of another one.
+func (g *flightGroup) Do(key string, fn func() ([]byte, error)) (val []byte, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+	return c.val, c.err, false
+}
@@ -0,0 +1,148 @@
+package dsync
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// DBarrierLease - how long an arrival at a DBarrier stays registered
+// without being renewed by its participant.
+const DBarrierLease = 10 * time.Second
+
+const counterPollInterval = 100 * time.Millisecond
+
+// ErrNoQuorum is returned when too few lock servers answered a counter
+// operation of DBarrier or DLatch.
+var ErrNoQuorum = errors.New("dsync: lock server quorum not reached")
+
+// A DBarrier is a distributed barrier, it blocks its participants until
+// Parties of them arrived.
+//
+// A barrier trips once, use a fresh name for every round.
+type DBarrier struct {
+	Name    string
+	Parties int
+	clnt    *Dsync
+}
+
+// NewDBarrier - initializes a new dsync barrier for parties participants.
+func NewDBarrier(clnt *Dsync, name string, parties int) *DBarrier {
+	return &DBarrier{
+		Name:    name,
+		Parties: parties,
+		clnt:    clnt,
+	}
+}
+
+// Wait registers the participant id at the barrier and blocks until all
+// parties arrived or ctx is done.
+//
+// The arrival is renewed while waiting. A participant that crashes stops
+// renewing it and is dropped after DBarrierLease, so the barrier does not
+// trip on its behalf.
+func (b *DBarrier) Wait(ctx context.Context, id string) error {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	args := CounterArgs{
+		UID:    id,
+		Name:   b.Name,
+		Target: b.Parties,
+		TTL:    DBarrierLease,
+	}
+
+	// Leave in any case, also when ctx is done, once tripped the barrier
+	// stays tripped for the participants still polling. Past the lease the
+	// arrival is gone anyway.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DBarrierLease)
+		defer cancel()
+		broadcastCounter(ctx, b.clnt, func(c NetCounter) (CounterReply, error) {
+			_, err := c.Depart(args)
+			return CounterReply{}, err
+		})
+	}()
+
+	var renewed time.Time
+	for {
+		var replies []CounterReply
+		var quorum int
+		if time.Since(renewed) >= DBarrierLease/3 {
+			replies, quorum = broadcastCounter(ctx, b.clnt, func(c NetCounter) (CounterReply, error) {
+				return c.Arrive(ctx, args)
+			})
+			if len(replies) >= quorum {
+				renewed = time.Now()
+			}
+		} else {
+			replies, quorum = broadcastCounter(ctx, b.clnt, func(c NetCounter) (CounterReply, error) {
+				return c.Count(ctx, args)
+			})
+		}
+		if countTripped(replies) >= quorum {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration((0.5 + r.Float64()) * float64(counterPollInterval))):
+		}
+	}
+}
+
+// broadcastCounter runs op against every lock server and returns the
+// replies of those that succeeded, with the number of replies a quorum
+// needs. It returns as soon as a quorum replied, every server answered or
+// ctx is done, the remaining calls finish in the background. Lock servers
+// not implementing NetCounter count as failed.
+func broadcastCounter(ctx context.Context, ds *Dsync, op func(c NetCounter) (CounterReply, error)) (replies []CounterReply, quorum int) {
+	restClnts := ds.GetLockersFn()
+	quorum = len(restClnts)/2 + 1
+
+	type result struct {
+		reply CounterReply
+		err   error
+	}
+	results := make(chan result, len(restClnts))
+	pending := 0
+	for _, c := range restClnts {
+		nc, ok := c.(NetCounter)
+		if !ok {
+			log("dsync: locker %v does not support counters\n", c)
+			continue
+		}
+
+		pending++
+		go func(nc NetCounter) {
+			reply, err := op(nc)
+			if err != nil {
+				log("dsync: counter operation failed with %s at %s\n", err, nc)
+			}
+			results <- result{reply, err}
+		}(nc)
+	}
+
+	for ; pending > 0 && len(replies) < quorum; pending-- {
+		select {
+		case res := <-results:
+			if res.err == nil {
+				replies = append(replies, res.reply)
+			}
+		case <-ctx.Done():
+			return replies, quorum
+		}
+	}
+	return replies, quorum
+}
+
+// countTripped returns the number of replies reporting a tripped counter.
+func countTripped(replies []CounterReply) int {
+	n := 0
+	for _, reply := range replies {
+		if reply.Tripped {
+			n++
+		}
+	}
+	return n
+}
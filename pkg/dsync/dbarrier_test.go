@@ -0,0 +1,120 @@
+package dsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newLocalDsync returns a Dsync backed by n in-process lock servers, of
+// which the last down ones are offline.
+func newLocalDsync(n, down int) *Dsync {
+	lockers := make([]NetLocker, n)
+	for i := 0; i < n-down; i++ {
+		lockers[i] = NewLocalLocker(NewLockServer())
+	}
+	return &Dsync{GetLockersFn: func() []NetLocker { return lockers }}
+}
+
+func TestBarrier(t *testing.T) {
+	ds := newLocalDsync(5, 2)
+
+	const parties = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, parties)
+	for i := 0; i < parties; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(time.Duration(i) * 50 * time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			errs <- NewDBarrier(ds, "barrier", parties).Wait(ctx, fmt.Sprintf("worker-%d", i))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Wait() = %v, want nil", err)
+		}
+	}
+}
+
+func TestBarrierIncomplete(t *testing.T) {
+	ds := newLocalDsync(3, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := NewDBarrier(ds, "barrier", 2).Wait(ctx, "lonely"); err != context.DeadlineExceeded {
+		t.Fatalf("Wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The canceled participant left, so a single newcomer must not trip it.
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := NewDBarrier(ds, "barrier", 2).Wait(ctx, "late"); err != context.DeadlineExceeded {
+		t.Fatalf("Wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// blackhole is a lock server that never answers, whatever the context.
+type blackhole struct {
+	NetLocker
+	never chan struct{}
+}
+
+func (b blackhole) Arrive(ctx context.Context, args CounterArgs) (CounterReply, error) {
+	<-b.never
+	return CounterReply{}, nil
+}
+
+func (b blackhole) Count(ctx context.Context, args CounterArgs) (CounterReply, error) {
+	<-b.never
+	return CounterReply{}, nil
+}
+
+func (b blackhole) Depart(args CounterArgs) (bool, error) {
+	<-b.never
+	return false, nil
+}
+
+func TestBarrierBlackhole(t *testing.T) {
+	never := make(chan struct{})
+	defer close(never)
+	ds := newLocalDsync(3, 0)
+	lockers := ds.GetLockersFn()
+	lockers[2] = blackhole{never: never}
+
+	// A quorum answers, the silent server is not waited for.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := NewDBarrier(ds, "barrier", 1).Wait(ctx, "solo"); err != nil {
+		t.Fatalf("Wait() = %v, want nil", err)
+	}
+
+	// Neither does a barrier that does not trip keep its deadline waiting.
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := NewDBarrier(ds, "pair", 2).Wait(ctx, "solo"); err != context.DeadlineExceeded {
+		t.Fatalf("Wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Without a quorum the deadline still holds.
+	lockers[1] = blackhole{never: never}
+	latch := NewDLatch(ds, "latch", 1)
+	if err := latch.CountDown(ctx, "solo"); err != ErrNoQuorum {
+		t.Fatalf("CountDown() = %v, want %v", err, ErrNoQuorum)
+	}
+	if _, err := latch.Remaining(ctx); err != ErrNoQuorum {
+		t.Fatalf("Remaining() = %v, want %v", err, ErrNoQuorum)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Wait(), CountDown() and Remaining() took %v past a 200ms deadline", d)
+	}
+}
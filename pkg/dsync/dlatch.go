@@ -0,0 +1,94 @@
+package dsync
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// A DLatch is a distributed countdown latch, it lets waiters block until
+// Count distinct participants counted down.
+type DLatch struct {
+	Name  string
+	Count int
+	clnt  *Dsync
+}
+
+// NewDLatch - initializes a new dsync latch waiting for count participants.
+func NewDLatch(clnt *Dsync, name string, count int) *DLatch {
+	return &DLatch{
+		Name:  name,
+		Count: count,
+		clnt:  clnt,
+	}
+}
+
+// CountDown counts the latch down on behalf of participant id.
+//
+// Counting down is idempotent per id, a participant restarted after a
+// crash may safely count down again. ErrNoQuorum is returned when too few
+// lock servers recorded it, the call should then be retried.
+func (l *DLatch) CountDown(ctx context.Context, id string) error {
+	args := CounterArgs{UID: id, Name: l.Name, Target: l.Count}
+	replies, quorum := broadcastCounter(ctx, l.clnt, func(c NetCounter) (CounterReply, error) {
+		return c.Arrive(ctx, args)
+	})
+	if len(replies) < quorum {
+		return ErrNoQuorum
+	}
+	return nil
+}
+
+// Remaining returns the number of count downs the latch still waits for,
+// as agreed by a quorum of lock servers.
+func (l *DLatch) Remaining(ctx context.Context) (int, error) {
+	args := CounterArgs{Name: l.Name, Target: l.Count}
+	replies, quorum := broadcastCounter(ctx, l.clnt, func(c NetCounter) (CounterReply, error) {
+		return c.Count(ctx, args)
+	})
+	if len(replies) < quorum {
+		return 0, ErrNoQuorum
+	}
+	if countTripped(replies) >= quorum {
+		return 0, nil
+	}
+
+	// The count at least a quorum of servers has seen.
+	sort.Slice(replies, func(i, j int) bool { return replies[i].Count > replies[j].Count })
+	if remaining := l.Count - replies[quorum-1].Count; remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// Wait blocks until the latch reached zero or ctx is done. Lock servers
+// being unavailable for a while only delays it.
+func (l *DLatch) Wait(ctx context.Context) error {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for {
+		if remaining, err := l.Remaining(ctx); err == nil && remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration((0.5 + r.Float64()) * float64(counterPollInterval))):
+		}
+	}
+}
+
+// Reset drops the latch from all lock servers, after which it counts from
+// the start again.
+func (l *DLatch) Reset() error {
+	args := CounterArgs{Name: l.Name}
+	replies, quorum := broadcastCounter(context.Background(), l.clnt, func(c NetCounter) (CounterReply, error) {
+		_, err := c.Depart(args)
+		return CounterReply{}, err
+	})
+	if len(replies) < quorum {
+		return ErrNoQuorum
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package dsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLatch(t *testing.T) {
+	ds := newLocalDsync(5, 2)
+	ctx := context.Background()
+	latch := NewDLatch(ds, "latch", 3)
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		done <- latch.Wait(ctx)
+	}()
+
+	// Counting down twice with the same id only counts once.
+	for _, id := range []string{"a", "b", "b"} {
+		if err := latch.CountDown(ctx, id); err != nil {
+			t.Fatalf("CountDown(%s) = %v, want nil", id, err)
+		}
+	}
+	if remaining, err := latch.Remaining(ctx); remaining != 1 || err != nil {
+		t.Fatalf("Remaining() = %d, %v, want 1, nil", remaining, err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Wait() returned early with %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := latch.CountDown(ctx, "c"); err != nil {
+		t.Fatalf("CountDown(c) = %v, want nil", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Wait() = %v, want nil", err)
+	}
+
+	if err := latch.Reset(); err != nil {
+		t.Fatalf("Reset() = %v, want nil", err)
+	}
+	if remaining, _ := latch.Remaining(ctx); remaining != 3 {
+		t.Fatalf("Remaining() after Reset() = %d, want 3", remaining)
+	}
+}
+
+func TestLatchNoQuorum(t *testing.T) {
+	ds := newLocalDsync(3, 2)
+	if err := NewDLatch(ds, "latch", 1).CountDown(context.Background(), "a"); err != ErrNoQuorum {
+		t.Fatalf("CountDown() = %v, want %v", err, ErrNoQuorum)
+	}
+}
@@ -45,6 +45,11 @@ func log(format string, data ...interface{}) {
 const DRWMutexAcquireTimeout = 1 * time.Second // 1 second.
 const drwMutexInfinite = 1<<63 - 1
 
+// LockLease - lease of the locks taken by Lock and RLock. It is refreshed
+// every third of it while the lock is held, the lock servers drop the lock
+// of a client that crashed once it ran out.
+const LockLease = 30 * time.Second
+
 // A DRWMutex is a distributed mutual exclusion lock.
 type DRWMutex struct {
 	Names        []string
@@ -52,6 +57,10 @@ type DRWMutex struct {
 	readersLocks [][]string // Array of array of nodes that granted reader locks
 	m            sync.Mutex // Mutex to prevent multiple simultaneous locks from this node
 	clnt         *Dsync
+
+	// Stop refreshing the leases of the write lock and the read locks.
+	writeRefresh   func()
+	readersRefresh []func()
 }
 
 // Granted - represents a structure of a granted lock.
@@ -86,6 +95,7 @@ func (dm *DRWMutex) Lock(id, source string) {
 	isReadLock := false
 	dm.lockBlocking(context.Background(), id, source, isReadLock, Options{
 		Timeout: drwMutexInfinite,
+		Lease:   LockLease,
 	})
 }
 
@@ -93,6 +103,11 @@ func (dm *DRWMutex) Lock(id, source string) {
 type Options struct {
 	Timeout   time.Duration
 	Tolerance int
+
+	// Lease makes the lock servers drop the lock unless it is refreshed
+	// within the lease, which the DRWMutex does while it holds the lock.
+	// Zero takes the lock for good, until it is unlocked.
+	Lease time.Duration
 }
 
 // GetLock tries to get a write lock on dm before the timeout elapses.
@@ -115,6 +130,7 @@ func (dm *DRWMutex) RLock(id, source string) {
 	isReadLock := true
 	dm.lockBlocking(context.Background(), id, source, isReadLock, Options{
 		Timeout: drwMutexInfinite,
+		Lease:   LockLease,
 	})
 }
 
@@ -167,17 +183,23 @@ func (dm *DRWMutex) lockBlocking(ctx context.Context, id, source string, isReadL
 			return false
 		default:
 			// Try to acquire the lock.
-			if locked = lock(retryCtx, dm.clnt, &locks, id, source, isReadLock, opts.Tolerance, dm.Names...); locked {
+			if locked = lock(retryCtx, dm.clnt, &locks, id, source, isReadLock, opts.Tolerance, opts.Lease, dm.Names...); locked {
 				dm.m.Lock()
 
+				stop := func() {}
+				if opts.Lease > 0 {
+					stop = dm.keepAlive(append([]string(nil), locks...), opts.Lease)
+				}
 				// If success, copy array to object
 				if isReadLock {
 					// Append new array of strings at the end
 					dm.readersLocks = append(dm.readersLocks, make([]string, len(restClnts)))
 					// and copy stack array into last spot
 					copy(dm.readersLocks[len(dm.readersLocks)-1], locks[:])
+					dm.readersRefresh = append(dm.readersRefresh, stop)
 				} else {
 					copy(dm.writeLocks, locks[:])
+					dm.writeRefresh = stop
 				}
 
 				dm.m.Unlock()
@@ -189,27 +211,11 @@ func (dm *DRWMutex) lockBlocking(ctx context.Context, id, source string, isReadL
 }
 
 // lock tries to acquire the distributed lock, returning true or false.
-func lock(ctx context.Context, ds *Dsync, locks *[]string, id, source string, isReadLock bool, tolerance int, lockNames ...string) bool {
+func lock(ctx context.Context, ds *Dsync, locks *[]string, id, source string, isReadLock bool, tolerance int, lease time.Duration, lockNames ...string) bool {
 
 	restClnts := ds.GetLockersFn()
 
-	// Tolerance is not set, defaults to half of the locker clients.
-	if tolerance == 0 {
-		tolerance = len(restClnts) / 2
-	}
-
-	// Quorum is effectively = total clients subtracted with tolerance limit
-	quorum := len(restClnts) - tolerance
-	if !isReadLock {
-		// In situations for write locks, as a special case
-		// to avoid split brains we make sure to acquire
-		// quorum + 1 when tolerance is exactly half of the
-		// total locker clients.
-		if quorum == tolerance {
-			quorum++
-		}
-	}
-
+	quorum := lockQuorum(len(restClnts), tolerance, isReadLock)
 	tolerance = len(restClnts) - quorum
 
 	// Create buffered channel of size equal to total number of nodes.
@@ -235,6 +241,7 @@ func lock(ctx context.Context, ds *Dsync, locks *[]string, id, source string, is
 				UID:       id,
 				Resources: lockNames,
 				Source:    source,
+				TTL:       lease,
 			}
 
 			var locked bool
@@ -332,6 +339,28 @@ func lock(ctx context.Context, ds *Dsync, locks *[]string, id, source string, is
 	return quorumMet
 }
 
+// lockQuorum returns the number of lock servers out of n that have to
+// grant a lock.
+func lockQuorum(n, tolerance int, isReadLock bool) int {
+	// Tolerance is not set, defaults to half of the locker clients.
+	if tolerance == 0 {
+		tolerance = n / 2
+	}
+
+	// Quorum is effectively = total clients subtracted with tolerance limit
+	quorum := n - tolerance
+	if !isReadLock {
+		// In situations for write locks, as a special case
+		// to avoid split brains we make sure to acquire
+		// quorum + 1 when tolerance is exactly half of the
+		// total locker clients.
+		if quorum == tolerance {
+			quorum++
+		}
+	}
+	return quorum
+}
+
 // checkQuorumMet determines whether we have acquired the required quorum of underlying locks or not
 func checkQuorumMet(locks *[]string, quorum int) bool {
 	count := 0
@@ -383,6 +412,10 @@ func (dm *DRWMutex) Unlock() {
 		copy(locks, dm.writeLocks[:])
 		// Clear write locks array
 		dm.writeLocks = make([]string, len(restClnts))
+		if dm.writeRefresh != nil {
+			dm.writeRefresh()
+			dm.writeRefresh = nil
+		}
 	}
 
 	isReadLock := false
@@ -408,6 +441,8 @@ func (dm *DRWMutex) RUnlock() {
 		copy(locks, dm.readersLocks[0][:])
 		// Drop first element from array
 		dm.readersLocks = dm.readersLocks[1:]
+		dm.readersRefresh[0]()
+		dm.readersRefresh = dm.readersRefresh[1:]
 	}
 
 	isReadLock := true
@@ -428,6 +463,54 @@ func unlock(ds *Dsync, locks []string, isReadLock bool, restClnts []NetLocker, n
 	}
 }
 
+// keepAlive refreshes the lease of locks on the lock servers that granted
+// them every third of lease, until the returned func is called.
+func (dm *DRWMutex) keepAlive(locks []string, lease time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refreshAll(ctx, dm.clnt, locks, lease, dm.Names...)
+			}
+		}
+	}()
+	return cancel
+}
+
+// refreshAll renews the lease of locks on every lock server that granted
+// them, lock servers not implementing NetRefresher are skipped.
+func refreshAll(ctx context.Context, ds *Dsync, locks []string, lease time.Duration, names ...string) {
+	ctx, cancel := context.WithTimeout(ctx, lease/3)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for index, c := range ds.GetLockersFn() {
+		r, ok := c.(NetRefresher)
+		if !ok || index >= len(locks) || !isLocked(locks[index]) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(r NetRefresher, uid string) {
+			defer wg.Done()
+			args := LockArgs{UID: uid, Resources: names, TTL: lease}
+			held, err := r.Refresh(ctx, args)
+			switch {
+			case err != nil:
+				log("dsync: Unable to call Refresh failed with %s for %#v at %s\n", err, args, r)
+			case !held:
+				log("dsync: lease ran out for %#v at %s\n", args, r)
+			}
+		}(r, locks[index])
+	}
+	wg.Wait()
+}
+
 // sendRelease sends a release message to a node that previously granted a lock
 func sendRelease(ds *Dsync, c NetLocker, uid string, isReadLock bool, names ...string) {
 	if c == nil {
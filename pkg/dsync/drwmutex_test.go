@@ -24,7 +24,7 @@ import (
 	"testing"
 	"time"
 
-	. "github.com/minio/minio/pkg/dsync"
+	. "dutil/pkg/dsync"
 )
 
 const (
@@ -342,3 +342,30 @@ func BenchmarkRWMutexWorkWrite100(b *testing.B) {
 func BenchmarkRWMutexWorkWrite10(b *testing.B) {
 	benchmarkRWMutex(b, 100, 10)
 }
+
+func TestLockLease(t *testing.T) {
+	lockers := make([]NetLocker, 3)
+	for i := range lockers {
+		lockers[i] = NewLocalLocker(NewLockServer())
+	}
+	ds := &Dsync{GetLockersFn: func() []NetLocker { return lockers }}
+	ctx := context.Background()
+
+	dm := NewDRWMutex(ds, "lease")
+	if !dm.GetLock(ctx, "a", "test", Options{Timeout: time.Second, Lease: 60 * time.Millisecond}) {
+		t.Fatal("GetLock() failed on a free lock")
+	}
+	// Held well past the lease, it is refreshed meanwhile.
+	time.Sleep(200 * time.Millisecond)
+	other := NewDRWMutex(ds, "lease")
+	if other.GetLock(ctx, "b", "test", Options{Timeout: 50 * time.Millisecond}) {
+		t.Fatal("GetLock() granted a lock whose lease is refreshed")
+	}
+
+	dm.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	if !other.GetLock(ctx, "b", "test", Options{Timeout: time.Second}) {
+		t.Fatal("GetLock() failed after Unlock()")
+	}
+	other.Unlock()
+}
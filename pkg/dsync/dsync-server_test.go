@@ -20,7 +20,7 @@ import (
 	"fmt"
 	"sync"
 
-	. "github.com/minio/minio/pkg/dsync"
+	. "dutil/pkg/dsync"
 )
 
 const WriteLock = -1
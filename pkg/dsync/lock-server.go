@@ -0,0 +1,437 @@
+package dsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LockInfo describes a single lock grant held by a LockServer.
+type LockInfo struct {
+	Resource string
+	UID      string
+	Source   string
+	Writer   bool
+	Since    time.Time
+	// Expires is the end of the lease of the grant, zero never expires.
+	Expires time.Time
+
+	// Last time the lock sweeper found the grant still valid.
+	checked time.Time
+}
+
+// LockServer is an in-memory lock table that serves the dsync protocol.
+// Register it with net/rpc under the "Dsync" service name and talk to it
+// through an RPCClient:
+//
+//	server := rpc.NewServer()
+//	server.RegisterName("Dsync", dsync.NewLockServer())
+//	server.HandleHTTP("/dsync", "/dsync-debug")
+type LockServer struct {
+	mutex sync.Mutex
+	// Grants per resource, a write lock is always the single entry.
+	lockMap map[string][]LockInfo
+	// Participant counters of barriers and latches.
+	counters map[string]*counter
+}
+
+// counter keeps the participants of a DBarrier or DLatch.
+type counter struct {
+	// Lease expiry per participant, zero never expires.
+	members map[string]time.Time
+	tripped bool
+}
+
+// NewLockServer returns an empty lock server.
+func NewLockServer() *LockServer {
+	return &LockServer{
+		lockMap:  make(map[string][]LockInfo),
+		counters: make(map[string]*counter),
+	}
+}
+
+// grants returns the grants on resource with those whose lease ran out
+// dropped, it returns the number dropped too.
+func (l *LockServer) grants(resource string, now time.Time) ([]LockInfo, int) {
+	grants := l.lockMap[resource]
+	live := grants[:0:0]
+	for _, g := range grants {
+		if g.Expires.IsZero() || now.Before(g.Expires) {
+			live = append(live, g)
+		}
+	}
+	if len(live) == len(grants) {
+		return grants, 0
+	}
+	if len(live) == 0 {
+		delete(l.lockMap, resource)
+	} else {
+		l.lockMap[resource] = live
+	}
+	return live, len(grants) - len(live)
+}
+
+// expiry returns the end of a lease of ttl from now, zero for none.
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+func (l *LockServer) canTakeLock(now time.Time, resources ...string) bool {
+	for _, resource := range resources {
+		if grants, _ := l.grants(resource, now); len(grants) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Lock grants a write lock on all of args.Resources, or none of them.
+func (l *LockServer) Lock(args *LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if *reply = l.canTakeLock(now, args.Resources...); !*reply {
+		return nil
+	}
+	for _, resource := range args.Resources {
+		l.lockMap[resource] = []LockInfo{{
+			Resource: resource,
+			UID:      args.UID,
+			Source:   args.Source,
+			Writer:   true,
+			Since:    now,
+			Expires:  expiry(now, args.TTL),
+		}}
+	}
+	return nil
+}
+
+// Unlock releases the write locks held by args.UID on args.Resources.
+func (l *LockServer) Unlock(args *LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, resource := range args.Resources {
+		grants, ok := l.lockMap[resource]
+		if !ok {
+			return fmt.Errorf("Unlock attempted on an unlocked entity: %s", resource)
+		}
+		if !grants[0].Writer {
+			return fmt.Errorf("Unlock attempted on a read locked entity: %s (%d read locks active)", resource, len(grants))
+		}
+		if grants[0].UID != args.UID {
+			return fmt.Errorf("Unlock attempted with a foreign UID on: %s", resource)
+		}
+	}
+	for _, resource := range args.Resources {
+		delete(l.lockMap, resource)
+	}
+	*reply = true
+	return nil
+}
+
+// RLock grants a read lock on args.Resources unless one of them is write locked.
+func (l *LockServer) RLock(args *LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	for _, resource := range args.Resources {
+		if grants, _ := l.grants(resource, now); len(grants) > 0 && grants[0].Writer {
+			*reply = false
+			return nil
+		}
+	}
+	for _, resource := range args.Resources {
+		l.lockMap[resource] = append(l.lockMap[resource], LockInfo{
+			Resource: resource,
+			UID:      args.UID,
+			Source:   args.Source,
+			Since:    now,
+			Expires:  expiry(now, args.TTL),
+		})
+	}
+	*reply = true
+	return nil
+}
+
+// RUnlock releases one read lock held by args.UID on args.Resources.
+func (l *LockServer) RUnlock(args *LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, resource := range args.Resources {
+		grants, ok := l.lockMap[resource]
+		if !ok {
+			return fmt.Errorf("RUnlock attempted on an unlocked entity: %s", resource)
+		}
+		if grants[0].Writer {
+			return fmt.Errorf("RUnlock attempted on a write locked entity: %s", resource)
+		}
+		if !l.holds(args.UID, resource) {
+			return fmt.Errorf("RUnlock attempted with a foreign UID on: %s", resource)
+		}
+	}
+	for _, resource := range args.Resources {
+		l.removeGrant(resource, args.UID)
+	}
+	*reply = true
+	return nil
+}
+
+// removeGrant drops the first grant of uid on resource, it reports
+// whether there was one.
+func (l *LockServer) removeGrant(resource, uid string) bool {
+	grants := l.lockMap[resource]
+	for i := range grants {
+		if grants[i].UID != uid {
+			continue
+		}
+		if len(grants) == 1 {
+			delete(l.lockMap, resource)
+		} else {
+			l.lockMap[resource] = append(grants[:i:i], grants[i+1:]...)
+		}
+		return true
+	}
+	return false
+}
+
+// Expired reports whether the lock args.UID held on args.Resources is gone
+// from this server.
+func (l *LockServer) Expired(args *LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	*reply = !l.holds(args.UID, args.Resources...)
+	return nil
+}
+
+func (l *LockServer) holds(uid string, resources ...string) bool {
+	now := time.Now()
+	for _, resource := range resources {
+		found := false
+		grants, _ := l.grants(resource, now)
+		for _, grant := range grants {
+			if grant.UID == uid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Refresh renews the leases of the grants args.UID holds on
+// args.Resources to args.TTL, it reports whether it holds all of them.
+func (l *LockServer) Refresh(args *LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if *reply = l.holds(args.UID, args.Resources...); !*reply {
+		return nil
+	}
+	now := time.Now()
+	for _, resource := range args.Resources {
+		grants := l.lockMap[resource]
+		for i := range grants {
+			if grants[i].UID == args.UID {
+				grants[i].Expires = expiry(now, args.TTL)
+			}
+		}
+	}
+	return nil
+}
+
+// ForceUnlock drops every lock on args.Resources, regardless of its kind
+// and holder. The UID must be left empty.
+func (l *LockServer) ForceUnlock(args *LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(args.UID) != 0 {
+		return fmt.Errorf("ForceUnlock called with non-empty UID: %s", args.UID)
+	}
+	for _, resource := range args.Resources {
+		delete(l.lockMap, resource)
+	}
+	*reply = true
+	return nil
+}
+
+// Locks lists the locks held on args.Resources, or all of them when no
+// resource is given, sorted by resource name.
+func (l *LockServer) Locks(args *LockArgs, reply *[]LockInfo) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	resources := args.Resources
+	if len(resources) == 0 {
+		for resource := range l.lockMap {
+			resources = append(resources, resource)
+		}
+	}
+	var infos []LockInfo
+	for _, resource := range resources {
+		grants, _ := l.grants(resource, now)
+		infos = append(infos, grants...)
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].Resource < infos[j].Resource })
+	*reply = infos
+	return nil
+}
+
+// counter returns the counter called name with expired participants
+// dropped, or nil when there is none.
+func (l *LockServer) counter(name string, now time.Time) *counter {
+	c, ok := l.counters[name]
+	if !ok {
+		return nil
+	}
+	for uid, expiry := range c.members {
+		if !expiry.IsZero() && now.After(expiry) {
+			delete(c.members, uid)
+		}
+	}
+	if len(c.members) == 0 {
+		delete(l.counters, name)
+		return nil
+	}
+	return c
+}
+
+// Arrive adds args.UID to the counter args.Name, or renews its lease.
+func (l *LockServer) Arrive(args *CounterArgs, reply *CounterReply) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(args.UID) == 0 {
+		return fmt.Errorf("Arrive called with empty UID on: %s", args.Name)
+	}
+	now := time.Now()
+	c := l.counter(args.Name, now)
+	if c == nil {
+		c = &counter{members: make(map[string]time.Time)}
+		l.counters[args.Name] = c
+	}
+	var expiry time.Time
+	if args.TTL > 0 {
+		expiry = now.Add(args.TTL)
+	}
+	c.members[args.UID] = expiry
+	if args.Target > 0 && len(c.members) >= args.Target {
+		c.tripped = true
+	}
+	*reply = CounterReply{Count: len(c.members), Tripped: c.tripped}
+	return nil
+}
+
+// Count returns the state of the counter args.Name.
+func (l *LockServer) Count(args *CounterArgs, reply *CounterReply) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	*reply = CounterReply{}
+	if c := l.counter(args.Name, time.Now()); c != nil {
+		*reply = CounterReply{Count: len(c.members), Tripped: c.tripped}
+	}
+	return nil
+}
+
+// Depart removes args.UID from the counter args.Name, or drops the counter
+// altogether when the UID is empty.
+func (l *LockServer) Depart(args *CounterArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	c := l.counter(args.Name, time.Now())
+	if c == nil {
+		*reply = false
+		return nil
+	}
+	if len(args.UID) == 0 {
+		delete(l.counters, args.Name)
+		*reply = true
+		return nil
+	}
+	if _, *reply = c.members[args.UID]; *reply {
+		delete(c.members, args.UID)
+		if len(c.members) == 0 {
+			delete(l.counters, args.Name)
+		}
+	}
+	return nil
+}
+
+// localLocker adapts a LockServer living in the same process to NetLocker
+// and NetCounter.
+type localLocker struct {
+	srv *LockServer
+}
+
+// NewLocalLocker returns a NetLocker backed directly by srv, without any
+// network round trip.
+func NewLocalLocker(srv *LockServer) NetLocker {
+	return &localLocker{srv: srv}
+}
+
+func (l *localLocker) RLock(ctx context.Context, args LockArgs) (reply bool, err error) {
+	err = l.srv.RLock(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Lock(ctx context.Context, args LockArgs) (reply bool, err error) {
+	err = l.srv.Lock(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) RUnlock(args LockArgs) (reply bool, err error) {
+	err = l.srv.RUnlock(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Unlock(args LockArgs) (reply bool, err error) {
+	err = l.srv.Unlock(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Expired(ctx context.Context, args LockArgs) (reply bool, err error) {
+	err = l.srv.Expired(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Refresh(ctx context.Context, args LockArgs) (reply bool, err error) {
+	err = l.srv.Refresh(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Arrive(ctx context.Context, args CounterArgs) (reply CounterReply, err error) {
+	err = l.srv.Arrive(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Count(ctx context.Context, args CounterArgs) (reply CounterReply, err error) {
+	err = l.srv.Count(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Depart(args CounterArgs) (reply bool, err error) {
+	err = l.srv.Depart(&args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) String() string { return "local" }
+
+func (l *localLocker) Close() error { return nil }
+
+func (l *localLocker) IsOnline() bool { return true }
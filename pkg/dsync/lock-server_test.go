@@ -0,0 +1,98 @@
+package dsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockServerWriteLock(t *testing.T) {
+	l := NewLocalLocker(NewLockServer())
+	ctx := context.Background()
+
+	args := LockArgs{UID: "a", Resources: []string{"x", "y"}}
+	if ok, err := l.Lock(ctx, args); !ok || err != nil {
+		t.Fatalf("Lock() = %v, %v, want true, nil", ok, err)
+	}
+	if ok, _ := l.Lock(ctx, LockArgs{UID: "b", Resources: []string{"y", "z"}}); ok {
+		t.Fatal("Lock() granted on a write locked resource")
+	}
+	if ok, _ := l.RLock(ctx, LockArgs{UID: "b", Resources: []string{"x"}}); ok {
+		t.Fatal("RLock() granted on a write locked resource")
+	}
+	if _, err := l.Unlock(LockArgs{UID: "b", Resources: args.Resources}); err == nil {
+		t.Fatal("Unlock() with a foreign UID succeeded")
+	}
+	if expired, _ := l.Expired(ctx, args); expired {
+		t.Fatal("Expired() = true for a held lock")
+	}
+	if ok, err := l.Unlock(args); !ok || err != nil {
+		t.Fatalf("Unlock() = %v, %v, want true, nil", ok, err)
+	}
+	if expired, _ := l.Expired(ctx, args); !expired {
+		t.Fatal("Expired() = false for a released lock")
+	}
+}
+
+func TestLockServerReadLock(t *testing.T) {
+	srv := NewLockServer()
+	l := NewLocalLocker(srv)
+	ctx := context.Background()
+
+	for _, uid := range []string{"a", "b"} {
+		if ok, err := l.RLock(ctx, LockArgs{UID: uid, Resources: []string{"x"}}); !ok || err != nil {
+			t.Fatalf("RLock(%s) = %v, %v, want true, nil", uid, ok, err)
+		}
+	}
+	if ok, _ := l.Lock(ctx, LockArgs{UID: "c", Resources: []string{"x"}}); ok {
+		t.Fatal("Lock() granted on a read locked resource")
+	}
+
+	var locks []LockInfo
+	srv.Locks(&LockArgs{}, &locks)
+	if len(locks) != 2 {
+		t.Fatalf("Locks() returned %d grants, want 2", len(locks))
+	}
+
+	if ok, err := l.RUnlock(LockArgs{UID: "a", Resources: []string{"x"}}); !ok || err != nil {
+		t.Fatalf("RUnlock() = %v, %v, want true, nil", ok, err)
+	}
+	if expired, _ := l.Expired(ctx, LockArgs{UID: "b", Resources: []string{"x"}}); expired {
+		t.Fatal("RUnlock() released a foreign read lock")
+	}
+
+	var reply bool
+	if err := srv.ForceUnlock(&LockArgs{Resources: []string{"x"}}, &reply); err != nil || !reply {
+		t.Fatalf("ForceUnlock() = %v, %v, want true, nil", reply, err)
+	}
+	if ok, _ := l.Lock(ctx, LockArgs{UID: "c", Resources: []string{"x"}}); !ok {
+		t.Fatal("Lock() not granted after ForceUnlock()")
+	}
+}
+
+func TestLockServerLease(t *testing.T) {
+	l := NewLocalLocker(NewLockServer())
+	r := l.(NetRefresher)
+	ctx := context.Background()
+
+	args := LockArgs{UID: "a", Resources: []string{"x"}, TTL: 50 * time.Millisecond}
+	if ok, err := l.Lock(ctx, args); !ok || err != nil {
+		t.Fatalf("Lock() = %v, %v, want true, nil", ok, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, err := r.Refresh(ctx, args); !ok || err != nil {
+		t.Fatalf("Refresh() = %v, %v, want true, nil", ok, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := l.Lock(ctx, LockArgs{UID: "b", Resources: []string{"x"}}); ok {
+		t.Fatal("Lock() granted on a refreshed lease")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := r.Refresh(ctx, args); ok {
+		t.Fatal("Refresh() = true after the lease ran out")
+	}
+	if ok, _ := l.Lock(ctx, LockArgs{UID: "b", Resources: []string{"x"}}); !ok {
+		t.Fatal("Lock() not granted after the lease ran out")
+	}
+}
@@ -0,0 +1,125 @@
+package dsync
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LockValidity - grants held longer than this are checked against the
+// quorum by the lock sweeper, and then again after every such period.
+const LockValidity = 1 * time.Minute
+
+// RunSweeper sweeps stale grants off l every interval until ctx is done.
+// ds must reach every lock server of the cluster, l included.
+//
+// The lock of a client that crashed while holding it is swept once its
+// lease ran out, see LockArgs.TTL. Locks taken without a lease are only
+// swept when a quorum no longer agrees on them.
+func (l *LockServer) RunSweeper(ctx context.Context, ds *Dsync, interval, validity time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := l.Sweep(ctx, ds, validity); n > 0 {
+				log("dsync: swept %d stale lock grants\n", n)
+			}
+		}
+	}
+}
+
+// Sweep drops the grants of l whose lease ran out, left behind by clients
+// that crashed or lost touch holding them. It then asks the lock servers
+// of ds whether the grants l holds for longer than validity are still held
+// by them, and drops those a lock quorum no longer agrees on. It returns
+// the number of dropped grants.
+//
+// The latter are left behind by clients that crashed half way through
+// locking or unlocking. A grant is kept when too few lock servers answered
+// to decide.
+func (l *LockServer) Sweep(ctx context.Context, ds *Dsync, validity time.Duration) int {
+	now := time.Now()
+
+	swept := 0
+	var stale []LockInfo
+	l.mutex.Lock()
+	for resource := range l.lockMap {
+		grants, expired := l.grants(resource, now)
+		swept += expired
+		for i := range grants {
+			if now.Sub(grants[i].Since) < validity || now.Sub(grants[i].checked) < validity {
+				continue
+			}
+			grants[i].checked = now
+			stale = append(stale, grants[i])
+		}
+	}
+	l.mutex.Unlock()
+
+	restClnts := ds.GetLockersFn()
+	for _, grant := range stale {
+		held, answered := countHeld(ctx, restClnts, grant)
+		quorum := lockQuorum(len(restClnts), 0, !grant.Writer)
+		if answered < quorum || held >= quorum {
+			continue
+		}
+
+		l.mutex.Lock()
+		if l.removeGrantSince(grant) {
+			swept++
+		}
+		l.mutex.Unlock()
+	}
+	return swept
+}
+
+// countHeld asks every lock server whether it still holds grant, it returns
+// how many do and how many answered at all.
+func countHeld(ctx context.Context, restClnts []NetLocker, grant LockInfo) (held, answered int) {
+	args := LockArgs{
+		UID:       grant.UID,
+		Resources: []string{grant.Resource},
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range restClnts {
+		if c == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(c NetLocker) {
+			defer wg.Done()
+			expired, err := c.Expired(ctx, args)
+			if err != nil {
+				log("dsync: Unable to call Expired failed with %s for %#v at %s\n", err, args, c)
+				return
+			}
+			mu.Lock()
+			answered++
+			if !expired {
+				held++
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	return held, answered
+}
+
+// removeGrantSince drops grant unless it has been released and granted
+// anew in the meantime.
+func (l *LockServer) removeGrantSince(grant LockInfo) bool {
+	for _, g := range l.lockMap[grant.Resource] {
+		if g.UID == grant.UID && g.Since.Equal(grant.Since) {
+			return l.removeGrant(grant.Resource, grant.UID)
+		}
+	}
+	return false
+}
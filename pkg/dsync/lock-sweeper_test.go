@@ -0,0 +1,79 @@
+package dsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSweep(t *testing.T) {
+	servers := make([]*LockServer, 3)
+	lockers := make([]NetLocker, 3)
+	for i := range servers {
+		servers[i] = NewLockServer()
+		lockers[i] = NewLocalLocker(servers[i])
+	}
+	ds := &Dsync{GetLockersFn: func() []NetLocker { return lockers }}
+	ctx := context.Background()
+
+	// "held" is granted by all servers, "orphan" only by the first one, as
+	// left behind by a client dying half way through.
+	for _, l := range lockers {
+		l.Lock(ctx, LockArgs{UID: "a", Resources: []string{"held"}})
+	}
+	lockers[0].Lock(ctx, LockArgs{UID: "b", Resources: []string{"orphan"}})
+
+	if n := servers[0].Sweep(ctx, ds, time.Hour); n != 0 {
+		t.Fatalf("Sweep() dropped %d fresh grants", n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := servers[0].Sweep(ctx, ds, time.Millisecond); n != 1 {
+		t.Fatalf("Sweep() dropped %d grants, want 1", n)
+	}
+	if expired, _ := lockers[0].Expired(ctx, LockArgs{UID: "b", Resources: []string{"orphan"}}); !expired {
+		t.Fatal("orphaned grant survived Sweep()")
+	}
+	if expired, _ := lockers[0].Expired(ctx, LockArgs{UID: "a", Resources: []string{"held"}}); expired {
+		t.Fatal("Sweep() dropped a grant held by the quorum")
+	}
+}
+
+func TestSweepUndecided(t *testing.T) {
+	srv := NewLockServer()
+	lockers := []NetLocker{NewLocalLocker(srv), nil, nil}
+	ds := &Dsync{GetLockersFn: func() []NetLocker { return lockers }}
+	ctx := context.Background()
+
+	lockers[0].Lock(ctx, LockArgs{UID: "a", Resources: []string{"x"}})
+	time.Sleep(10 * time.Millisecond)
+	if n := srv.Sweep(ctx, ds, time.Millisecond); n != 0 {
+		t.Fatalf("Sweep() dropped %d grants without a quorum answering", n)
+	}
+}
+
+func TestSweepLease(t *testing.T) {
+	servers := make([]*LockServer, 3)
+	lockers := make([]NetLocker, 3)
+	for i := range servers {
+		servers[i] = NewLockServer()
+		lockers[i] = NewLocalLocker(servers[i])
+	}
+	ds := &Dsync{GetLockersFn: func() []NetLocker { return lockers }}
+	ctx := context.Background()
+
+	// Both are held by all servers, the client holding "crashed" stopped
+	// refreshing its lease.
+	for _, l := range lockers {
+		l.Lock(ctx, LockArgs{UID: "a", Resources: []string{"crashed"}, TTL: time.Millisecond})
+		l.Lock(ctx, LockArgs{UID: "b", Resources: []string{"held"}})
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := servers[0].Sweep(ctx, ds, time.Hour); n != 1 {
+		t.Fatalf("Sweep() dropped %d grants, want 1", n)
+	}
+	var locks []LockInfo
+	servers[0].Locks(&LockArgs{}, &locks)
+	if len(locks) != 1 || locks[0].UID != "b" {
+		t.Fatalf("Locks() = %v after Sweep(), want the grant of b", locks)
+	}
+}
@@ -16,7 +16,10 @@
 
 package dsync
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // LockArgs is minimal required values for any dsync compatible lock operation.
 type LockArgs struct {
@@ -29,6 +32,10 @@ type LockArgs struct {
 	// Source contains the line number, function and file name of the code
 	// on the client node that requested the lock.
 	Source string
+
+	// TTL is the lease of the lock, it has to be refreshed before the lease
+	// runs out or the lock servers drop it. Zero never expires.
+	TTL time.Duration
 }
 
 // NetLocker is dsync compatible locker interface.
@@ -65,3 +72,51 @@ type NetLocker interface {
 	// Is the underlying connection online? (is always true for any local lockers)
 	IsOnline() bool
 }
+
+// NetRefresher is implemented by lock servers that expire the leases of
+// locks, see LockArgs.TTL.
+type NetRefresher interface {
+	// Refresh renews the lease of the lock args.UID holds on
+	// args.Resources to args.TTL. It reports whether the lock is still
+	// held, a lock whose lease ran out is gone for good.
+	Refresh(ctx context.Context, args LockArgs) (bool, error)
+}
+
+// CounterArgs is minimal required values for the participant counters
+// backing DBarrier and DLatch.
+type CounterArgs struct {
+	// Unique ID of the participant, empty to address the whole counter.
+	UID string
+
+	// Name of the counter.
+	Name string
+
+	// Target is the participant count at which the counter trips. A
+	// tripped counter stays tripped until all its participants left.
+	Target int
+
+	// TTL is the lease of the participant, it has to arrive again before
+	// the lease runs out or it is dropped. Zero never expires.
+	TTL time.Duration
+}
+
+// CounterReply is the state of a counter on a single lock server.
+type CounterReply struct {
+	Count   int
+	Tripped bool
+}
+
+// NetCounter is implemented by lock servers that also keep participant
+// counters, as required by DBarrier and DLatch.
+type NetCounter interface {
+	// Arrive registers args.UID as a participant of args.Name, or
+	// refreshes its lease, and returns the resulting counter state.
+	Arrive(ctx context.Context, args CounterArgs) (CounterReply, error)
+
+	// Count returns the counter state of args.Name.
+	Count(ctx context.Context, args CounterArgs) (CounterReply, error)
+
+	// Depart removes args.UID from args.Name, or the whole counter when
+	// args.UID is empty.
+	Depart(args CounterArgs) (bool, error)
+}
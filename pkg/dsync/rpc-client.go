@@ -0,0 +1,187 @@
+package dsync
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// RPCClient is a NetLocker and NetCounter talking to a LockServer over
+// net/rpc. It connects lazily and reconnects once when the connection was
+// shut down. Calls taking a context give up when it is done.
+type RPCClient struct {
+	mutex    sync.Mutex
+	rpc      *rpc.Client
+	addr     string
+	endpoint string
+}
+
+// NewRPCClient returns a client for the lock server serving endpoint at addr.
+// It doesn't connect until the first call.
+func NewRPCClient(addr, endpoint string) *RPCClient {
+	return &RPCClient{
+		addr:     addr,
+		endpoint: endpoint,
+	}
+}
+
+// IsOnline reports whether a connection to the server is established.
+func (c *RPCClient) IsOnline() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.rpc != nil
+}
+
+// Close closes the underlying connection, a later call reconnects.
+func (c *RPCClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.rpc == nil {
+		return nil
+	}
+	clnt := c.rpc
+	c.rpc = nil
+	return clnt.Close()
+}
+
+// rpcDialTimeout bounds connecting to a lock server, whatever the context
+// of the call allows.
+const rpcDialTimeout = 5 * time.Second
+
+// client returns the connection to the server, connecting if there is none.
+func (c *RPCClient) client(ctx context.Context) (*rpc.Client, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.rpc != nil {
+		return c.rpc, nil
+	}
+
+	d := net.Dialer{Timeout: rpcDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	// The HTTP handshake of rpc.DialHTTPPath, bounded alike.
+	deadline := time.Now().Add(rpcDialTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	io.WriteString(conn, "CONNECT "+c.endpoint+" HTTP/1.0\n\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && resp.Status != "200 Connected to Go RPC" {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "dial-http", Net: "tcp " + c.addr, Err: err}
+	}
+	conn.SetDeadline(time.Time{})
+	c.rpc = rpc.NewClient(conn)
+	return c.rpc, nil
+}
+
+// reset drops clnt, a shut down connection, unless it was replaced already.
+func (c *RPCClient) reset(clnt *rpc.Client) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.rpc == clnt {
+		clnt.Close()
+		c.rpc = nil
+	}
+}
+
+// call makes a RPC call to the remote endpoint using encoding/gob. It gives
+// up when ctx is done, the call is left to finish in the background.
+func (c *RPCClient) call(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	for attempt := 0; ; attempt++ {
+		clnt, err := c.client(ctx)
+		if err != nil {
+			return err
+		}
+		// An abandoned call may still write its reply, so it gets its own.
+		v := reflect.New(reflect.TypeOf(reply).Elem())
+		call := clnt.Go(serviceMethod, args, v.Interface(), make(chan *rpc.Call, 1))
+		select {
+		case <-call.Done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if call.Error == rpc.ErrShutdown && attempt == 0 {
+			c.reset(clnt)
+			continue
+		}
+		if call.Error == nil {
+			reflect.ValueOf(reply).Elem().Set(v.Elem())
+		}
+		return call.Error
+	}
+}
+
+func (c *RPCClient) RLock(ctx context.Context, args LockArgs) (status bool, err error) {
+	err = c.call(ctx, "Dsync.RLock", &args, &status)
+	return status, err
+}
+
+func (c *RPCClient) Lock(ctx context.Context, args LockArgs) (status bool, err error) {
+	err = c.call(ctx, "Dsync.Lock", &args, &status)
+	return status, err
+}
+
+func (c *RPCClient) RUnlock(args LockArgs) (status bool, err error) {
+	err = c.call(context.Background(), "Dsync.RUnlock", &args, &status)
+	return status, err
+}
+
+func (c *RPCClient) Unlock(args LockArgs) (status bool, err error) {
+	err = c.call(context.Background(), "Dsync.Unlock", &args, &status)
+	return status, err
+}
+
+func (c *RPCClient) Expired(ctx context.Context, args LockArgs) (expired bool, err error) {
+	err = c.call(ctx, "Dsync.Expired", &args, &expired)
+	return expired, err
+}
+
+func (c *RPCClient) Refresh(ctx context.Context, args LockArgs) (status bool, err error) {
+	err = c.call(ctx, "Dsync.Refresh", &args, &status)
+	return status, err
+}
+
+// ForceUnlock drops all locks on args.Resources, whoever holds them.
+func (c *RPCClient) ForceUnlock(args LockArgs) (status bool, err error) {
+	err = c.call(context.Background(), "Dsync.ForceUnlock", &args, &status)
+	return status, err
+}
+
+// Locks lists the locks held on args.Resources, or all locks when empty.
+func (c *RPCClient) Locks(args LockArgs) (locks []LockInfo, err error) {
+	err = c.call(context.Background(), "Dsync.Locks", &args, &locks)
+	return locks, err
+}
+
+func (c *RPCClient) Arrive(ctx context.Context, args CounterArgs) (reply CounterReply, err error) {
+	err = c.call(ctx, "Dsync.Arrive", &args, &reply)
+	return reply, err
+}
+
+func (c *RPCClient) Count(ctx context.Context, args CounterArgs) (reply CounterReply, err error) {
+	err = c.call(ctx, "Dsync.Count", &args, &reply)
+	return reply, err
+}
+
+func (c *RPCClient) Depart(args CounterArgs) (status bool, err error) {
+	err = c.call(context.Background(), "Dsync.Depart", &args, &status)
+	return status, err
+}
+
+func (c *RPCClient) String() string {
+	return "http://" + c.addr + c.endpoint
+}
@@ -0,0 +1,66 @@
+package dsync
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRPCClient(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Dsync", NewLockServer()); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/dsync", server)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewRPCClient(strings.TrimPrefix(srv.URL, "http://"), "/dsync")
+	defer c.Close()
+	args := LockArgs{UID: "a", Resources: []string{"x"}}
+	if ok, err := c.Lock(context.Background(), args); !ok || err != nil {
+		t.Fatalf("Lock() = %v, %v, want true", ok, err)
+	}
+	if ok, err := c.Lock(context.Background(), LockArgs{UID: "b", Resources: []string{"x"}}); ok || err != nil {
+		t.Fatalf("Lock() of a held lock = %v, %v, want false", ok, err)
+	}
+	if ok, err := c.Unlock(args); !ok || err != nil {
+		t.Fatalf("Unlock() = %v, %v, want true", ok, err)
+	}
+}
+
+func TestRPCClientContext(t *testing.T) {
+	// A server that accepts connections and never answers.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := NewRPCClient(l.Addr().String(), "/dsync")
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Lock(ctx, LockArgs{UID: "a", Resources: []string{"x"}}); err == nil {
+		t.Fatal("Lock() of a silent server succeeded")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Lock() took %v past a 200ms deadline", d)
+	}
+}
@@ -0,0 +1,131 @@
+package filter
+
+import (
+	"errors"
+	"math"
+
+	"dutil/pkg/murmur3"
+)
+
+var ErrInvalidRate = errors.New("false positive rate must be within (0, 1)")
+
+// BloomParams returns the number of bits m and hashes k of a bloom filter
+// holding n items at a false positive rate of fp.
+func BloomParams(n uint64, fp float64) (m uint64, k uint32) {
+	if n == 0 {
+		n = 1
+	}
+	m = uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k = uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+	return m, k
+}
+
+// Bloom is a bloom filter sized for the number of items it is to hold, its
+// bits packed into words. The k bit indices of an item are derived from a
+// single 128 bit murmur3 hash by double hashing.
+type Bloom struct {
+	m     uint64 // bits
+	k     uint32 // indices per item
+	seed  uint32
+	count uint64 // items put
+	bits  []uint64
+}
+
+var _ BloomFilter = (*Bloom)(nil)
+
+// NewBloom returns a bloom filter that keeps a false positive rate of fp
+// for up to n items.
+func NewBloom(n uint64, fp float64) (*Bloom, error) {
+	if !(fp > 0 && fp < 1) {
+		return nil, ErrInvalidRate
+	}
+	m, k := BloomParams(n, fp)
+	return NewBloomWithParams(m, k, 0), nil
+}
+
+// NewBloomWithParams returns a bloom filter of m bits setting k of them
+// per item, hashing with seed.
+func NewBloomWithParams(m uint64, k uint32, seed uint32) *Bloom {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &Bloom{m: m, k: k, seed: seed, bits: make([]uint64, (m+63)/64)}
+}
+
+// indices calls fn with the k indices out of m of data until it returns
+// false, derived from one murmur3 hash with seed by double hashing.
+func indices(data []byte, seed uint32, m uint64, k uint32, fn func(i uint64) bool) {
+	h1, h2 := murmur3.Sum128WithSeed(data, seed)
+	// murmur3 hashes data of up to 8 bytes as long as the seed to h1 = 2x
+	// and h2 = 3x, the indices of all such items would share a pattern.
+	h2 = mix64(h2)
+	for i := uint32(0); i < k; i++ {
+		if !fn((h1 + uint64(i)*h2) % m) {
+			return
+		}
+	}
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+func (b *Bloom) indices(data []byte, fn func(i uint64) bool) {
+	indices(data, b.seed, b.m, b.k, fn)
+}
+
+func (b *Bloom) Put(data []byte) {
+	b.indices(data, func(i uint64) bool {
+		b.bits[i/64] |= 1 << (i % 64)
+		return true
+	})
+	b.count++
+}
+
+func (b *Bloom) Contains(data []byte) bool {
+	found := true
+	b.indices(data, func(i uint64) bool {
+		found = b.bits[i/64]&(1<<(i%64)) != 0
+		return found
+	})
+	return found
+}
+
+// Delete clears the bits of data. Other items sharing any of them are lost
+// with it, use a CountingBloom to delete items.
+func (b *Bloom) Delete(data []byte) {
+	if !b.Contains(data) {
+		return
+	}
+	b.indices(data, func(i uint64) bool {
+		b.bits[i/64] &^= 1 << (i % 64)
+		return true
+	})
+	if b.count > 0 {
+		b.count--
+	}
+}
+
+// M returns the number of bits of b.
+func (b *Bloom) M() uint64 { return b.m }
+
+// K returns the number of bits set per item.
+func (b *Bloom) K() uint32 { return b.k }
+
+// Count returns the number of items put.
+func (b *Bloom) Count() uint64 { return b.count }
+
+// FPRate returns the expected false positive rate for the items put so
+// far.
+func (b *Bloom) FPRate() float64 {
+	return math.Pow(1-math.Exp(-float64(b.k)*float64(b.count)/float64(b.m)), float64(b.k))
+}
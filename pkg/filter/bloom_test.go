@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBloomParams(t *testing.T) {
+	// 1M items at 1% take about 9.59 bits each and 7 hashes.
+	m, k := BloomParams(1000000, 0.01)
+	if m != 9585059 || k != 7 {
+		t.Fatalf("BloomParams() = %d, %d, want 9585059, 7", m, k)
+	}
+	if _, err := NewBloom(10, 1); err != ErrInvalidRate {
+		t.Fatalf("NewBloom() with a rate of 1 = %v, want %v", err, ErrInvalidRate)
+	}
+}
+
+func TestBloom(t *testing.T) {
+	const n = 10000
+	b, err := NewBloom(n, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := len(b.bits); uint64(words) != (b.M()+63)/64 {
+		t.Fatalf("%d words for %d bits", words, b.M())
+	}
+	for i := 0; i < n; i++ {
+		b.Put([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < n; i++ {
+		if !b.Contains([]byte(strconv.Itoa(i))) {
+			t.Fatalf("item %d missing", i)
+		}
+	}
+
+	fp := 0
+	for i := n; i < 11*n; i++ {
+		if b.Contains([]byte(strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / (10 * n); rate > 0.015 {
+		t.Fatalf("false positive rate %.4f, want about 0.01", rate)
+	}
+	if rate := b.FPRate(); rate < 0.008 || rate > 0.012 {
+		t.Fatalf("FPRate() = %.4f, want about 0.01", rate)
+	}
+
+	b.Delete([]byte("0"))
+	if b.Contains([]byte("0")) || b.Count() != n-1 {
+		t.Fatal("Delete() left the item in")
+	}
+}
+
+func TestBloomSeedLengthKeys(t *testing.T) {
+	// murmur3 hashes keys of up to 8 bytes as long as the seed to related
+	// halves, their indices must not share a pattern anyway.
+	const n = 10000
+	m, k := BloomParams(n, 0.01)
+	b := NewBloomWithParams(m, k, 4)
+	key := func(i int) []byte {
+		return []byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)}
+	}
+	for i := 0; i < n; i++ {
+		b.Put(key(i))
+	}
+	fp := 0
+	for i := n; i < 11*n; i++ {
+		if b.Contains(key(i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / (10 * n); rate > 0.015 {
+		t.Fatalf("false positive rate %.4f for 4 byte keys and seed 4, want about 0.01", rate)
+	}
+}
@@ -10,6 +10,8 @@ type BloomFilter interface {
 	Delete([]byte)
 }
 
+// bloomFilter64 is a fixed size filter of BitSize bits, one byte each. Use
+// NewBloom for a filter sized to its items.
 type bloomFilter64 struct {
 	BitArr [BitSize]byte
 	Seeds  []uint32
@@ -25,7 +27,7 @@ func NewBloomFilter64(seeds []uint32) *bloomFilter64 {
 
 func (b *bloomFilter64) Contains(data []byte) bool {
 	for _, s := range b.Seeds {
-		idx := murmur3.Sum64WithSeed(data, s)
+		idx := murmur3.Sum64WithSeed(data, s) % BitSize
 		if b.BitArr[idx] == 0 {
 			return false
 		}
@@ -35,7 +37,7 @@ func (b *bloomFilter64) Contains(data []byte) bool {
 
 func (b *bloomFilter64) Put(data []byte) {
 	for _, s := range b.Seeds {
-		idx := murmur3.Sum64WithSeed(data, s)
+		idx := murmur3.Sum64WithSeed(data, s) % BitSize
 		if b.BitArr[idx] == 0 {
 			b.BitArr[idx] = 1
 		}
@@ -44,7 +46,7 @@ func (b *bloomFilter64) Put(data []byte) {
 
 func (b *bloomFilter64) Delete(data []byte) {
 	for _, s := range b.Seeds {
-		idx := murmur3.Sum64WithSeed(data, s)
+		idx := murmur3.Sum64WithSeed(data, s) % BitSize
 		if b.BitArr[idx] == 0 {
 			return
 		}
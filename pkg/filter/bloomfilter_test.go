@@ -1 +1,18 @@
 package filter
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBloomFilter64(t *testing.T) {
+	b := NewBloomFilter64([]uint32{1, 2, 3})
+	for i := 0; i < 1000; i++ {
+		b.Put([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 1000; i++ {
+		if !b.Contains([]byte(strconv.Itoa(i))) {
+			t.Fatalf("item %d missing", i)
+		}
+	}
+}
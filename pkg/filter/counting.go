@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"errors"
+	"math"
+)
+
+// DefaultCounterBits is the width of the counters of a CountingBloom
+// unless told otherwise, enough for the counts of all but the most crowded
+// filters.
+const DefaultCounterBits = 4
+
+var ErrInvalidCounterBits = errors.New("counter bits must be 2, 4, 8 or 16")
+
+// CountingBloom is a bloom filter with a small counter in place of every
+// bit, so items can be deleted without losing others that share their
+// counters. A counter that reaches its maximum sticks there, as its true
+// count is unknown from then on. Such an overflow keeps the filter free of
+// false negatives at the cost of never clearing the counter again.
+type CountingBloom struct {
+	m         uint64 // counters
+	k         uint32 // counters per item
+	width     uint   // bits per counter
+	seed      uint32
+	count     uint64 // items put and not deleted
+	overflows uint64 // increments lost to saturated counters
+	words     []uint64
+}
+
+var _ BloomFilter = (*CountingBloom)(nil)
+
+// NewCountingBloom returns a counting bloom filter that keeps a false
+// positive rate of fp for up to n items, with counters of counterBits
+// bits, DefaultCounterBits if zero.
+func NewCountingBloom(n uint64, fp float64, counterBits uint) (*CountingBloom, error) {
+	if !(fp > 0 && fp < 1) {
+		return nil, ErrInvalidRate
+	}
+	m, k := BloomParams(n, fp)
+	return NewCountingBloomWithParams(m, k, counterBits, 0)
+}
+
+// NewCountingBloomWithParams returns a counting bloom filter of m counters
+// of counterBits bits, DefaultCounterBits if zero, counting k of them per
+// item and hashing with seed.
+func NewCountingBloomWithParams(m uint64, k uint32, counterBits uint, seed uint32) (*CountingBloom, error) {
+	if counterBits == 0 {
+		counterBits = DefaultCounterBits
+	}
+	switch counterBits {
+	case 2, 4, 8, 16:
+	default:
+		return nil, ErrInvalidCounterBits
+	}
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	perWord := 64 / uint64(counterBits)
+	return &CountingBloom{
+		m:     m,
+		k:     k,
+		width: counterBits,
+		seed:  seed,
+		words: make([]uint64, (m+perWord-1)/perWord),
+	}, nil
+}
+
+func (c *CountingBloom) max() uint64 { return 1<<c.width - 1 }
+
+// locate returns the word and bit offset of counter i.
+func (c *CountingBloom) locate(i uint64) (word uint64, shift uint) {
+	perWord := 64 / uint64(c.width)
+	return i / perWord, uint(i%perWord) * c.width
+}
+
+func (c *CountingBloom) get(i uint64) uint64 {
+	word, shift := c.locate(i)
+	return c.words[word] >> shift & c.max()
+}
+
+func (c *CountingBloom) set(i, v uint64) {
+	word, shift := c.locate(i)
+	c.words[word] = c.words[word]&^(c.max()<<shift) | v<<shift
+}
+
+func (c *CountingBloom) Put(data []byte) {
+	indices(data, c.seed, c.m, c.k, func(i uint64) bool {
+		if v := c.get(i); v < c.max() {
+			c.set(i, v+1)
+		} else {
+			c.overflows++
+		}
+		return true
+	})
+	c.count++
+}
+
+func (c *CountingBloom) Contains(data []byte) bool {
+	found := true
+	indices(data, c.seed, c.m, c.k, func(i uint64) bool {
+		found = c.get(i) != 0
+		return found
+	})
+	return found
+}
+
+// Delete removes data, which must have been put before. Deleting an item
+// that was never put can make others go missing, so items that are not
+// contained at all are left alone.
+func (c *CountingBloom) Delete(data []byte) {
+	if !c.Contains(data) {
+		return
+	}
+	indices(data, c.seed, c.m, c.k, func(i uint64) bool {
+		if v := c.get(i); v < c.max() {
+			c.set(i, v-1)
+		}
+		return true
+	})
+	if c.count > 0 {
+		c.count--
+	}
+}
+
+// M returns the number of counters of c.
+func (c *CountingBloom) M() uint64 { return c.m }
+
+// K returns the number of counters per item.
+func (c *CountingBloom) K() uint32 { return c.k }
+
+// CounterBits returns the width of the counters.
+func (c *CountingBloom) CounterBits() uint { return c.width }
+
+// Count returns the number of items put and not deleted.
+func (c *CountingBloom) Count() uint64 { return c.count }
+
+// Overflows returns the number of increments lost to saturated counters.
+func (c *CountingBloom) Overflows() uint64 { return c.overflows }
+
+// Saturated returns the number of counters stuck at their maximum.
+func (c *CountingBloom) Saturated() uint64 {
+	var n uint64
+	for i := uint64(0); i < c.m; i++ {
+		if c.get(i) == c.max() {
+			n++
+		}
+	}
+	return n
+}
+
+// FPRate returns the expected false positive rate for the items in c.
+func (c *CountingBloom) FPRate() float64 {
+	return math.Pow(1-math.Exp(-float64(c.k)*float64(c.count)/float64(c.m)), float64(c.k))
+}
@@ -0,0 +1,63 @@
+package filter
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCountingBloom(t *testing.T) {
+	const n = 5000
+	c, err := NewCountingBloom(n, 0.01, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		c.Put([]byte(strconv.Itoa(i)))
+	}
+	// Deleting half of the items keeps the other half.
+	for i := 0; i < n; i += 2 {
+		c.Delete([]byte(strconv.Itoa(i)))
+	}
+	for i := 1; i < n; i += 2 {
+		if !c.Contains([]byte(strconv.Itoa(i))) {
+			t.Fatalf("item %d missing after deleting others", i)
+		}
+	}
+	gone := 0
+	for i := 0; i < n; i += 2 {
+		if !c.Contains([]byte(strconv.Itoa(i))) {
+			gone++
+		}
+	}
+	if gone < n/2*95/100 {
+		t.Fatalf("only %d of %d deleted items are gone", gone, n/2)
+	}
+	if c.Count() != n/2 {
+		t.Fatalf("Count() = %d, want %d", c.Count(), n/2)
+	}
+	if _, err := NewCountingBloom(n, 0.01, 3); err != ErrInvalidCounterBits {
+		t.Fatalf("NewCountingBloom() with 3 bit counters = %v, want %v", err, ErrInvalidCounterBits)
+	}
+}
+
+func TestCountingBloomOverflow(t *testing.T) {
+	c, err := NewCountingBloomWithParams(64, 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 2 bit counter saturates at 3, the 4th put overflows it.
+	for i := 0; i < 4; i++ {
+		c.Put([]byte("x"))
+	}
+	if c.Overflows() != 1 || c.Saturated() != 1 {
+		t.Fatalf("Overflows() = %d, Saturated() = %d, want 1, 1", c.Overflows(), c.Saturated())
+	}
+	// Saturated counters never drop, so deletes cannot cause false
+	// negatives.
+	for i := 0; i < 4; i++ {
+		c.Delete([]byte("x"))
+	}
+	if !c.Contains([]byte("x")) {
+		t.Fatal("saturated counter was decremented")
+	}
+}
@@ -0,0 +1,238 @@
+package filter
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"dutil/pkg/murmur3"
+)
+
+const (
+	// BucketSize is the number of fingerprints per bucket of a Cuckoo.
+	BucketSize = 4
+	// MaxKicks bounds the fingerprints moved to make room for one item.
+	MaxKicks = 500
+)
+
+var (
+	ErrFull                   = errors.New("cuckoo filter is full")
+	ErrInvalidFingerprintBits = errors.New("fingerprint bits must be 8, 16 or 32")
+)
+
+// Cuckoo is a cuckoo filter, as described in "Cuckoo Filter: Practically
+// Better Than Bloom" by Fan et al. It keeps a small fingerprint of every
+// item in one of two buckets, the second one derived from the first and
+// the fingerprint alone, so items can be moved between them to make room
+// and deleted again. Below false positive rates of about 3% it takes less
+// space than a bloom filter.
+type Cuckoo struct {
+	buckets uint64 // a power of two
+	width   uint   // bits per fingerprint
+	seed    uint32
+	count   uint64
+	slots   []uint64 // fingerprints, 0 for an empty slot
+	rnd     *rand.Rand
+
+	// victim holds the fingerprint left homeless by an insertion that ran
+	// out of kicks, so no item goes missing. The filter is full as long as
+	// it is taken.
+	victim struct {
+		used  bool
+		index uint64
+		fp    uint64
+	}
+}
+
+var _ BloomFilter = (*Cuckoo)(nil)
+
+// NewCuckoo returns a cuckoo filter holding up to n items at a false
+// positive rate of at most fp.
+func NewCuckoo(n uint64, fp float64) (*Cuckoo, error) {
+	if !(fp > 0 && fp < 1) {
+		return nil, ErrInvalidRate
+	}
+	// A lookup compares against 2*BucketSize fingerprints of f bits.
+	bits := uint(8)
+	for bits < 32 && 2*BucketSize/math.Pow(2, float64(bits)) > fp {
+		bits *= 2
+	}
+	// Buckets fill up to about 95% before insertions start to fail.
+	buckets := uint64(math.Ceil(float64(n) / BucketSize / 0.95))
+	return NewCuckooWithParams(buckets, bits, 0)
+}
+
+// NewCuckooWithParams returns a cuckoo filter of buckets buckets, rounded
+// up to a power of two, holding fingerprints of fingerprintBits bits and
+// hashing with seed.
+func NewCuckooWithParams(buckets uint64, fingerprintBits uint, seed uint32) (*Cuckoo, error) {
+	switch fingerprintBits {
+	case 8, 16, 32:
+	default:
+		return nil, ErrInvalidFingerprintBits
+	}
+	n := uint64(1)
+	for n < buckets {
+		n <<= 1
+	}
+	perWord := 64 / uint64(fingerprintBits)
+	return &Cuckoo{
+		buckets: n,
+		width:   fingerprintBits,
+		seed:    seed,
+		slots:   make([]uint64, (n*BucketSize+perWord-1)/perWord),
+		rnd:     rand.New(rand.NewSource(int64(seed))),
+	}, nil
+}
+
+func (c *Cuckoo) fpMask() uint64 { return 1<<c.width - 1 }
+
+// slot returns the fingerprint in slot j of bucket i.
+func (c *Cuckoo) slot(i uint64, j int) uint64 {
+	n := i*BucketSize + uint64(j)
+	perWord := 64 / uint64(c.width)
+	return c.slots[n/perWord] >> (uint(n%perWord) * c.width) & c.fpMask()
+}
+
+func (c *Cuckoo) setSlot(i uint64, j int, fp uint64) {
+	n := i*BucketSize + uint64(j)
+	perWord := 64 / uint64(c.width)
+	shift := uint(n%perWord) * c.width
+	c.slots[n/perWord] = c.slots[n/perWord]&^(c.fpMask()<<shift) | fp<<shift
+}
+
+// locate returns the fingerprint of data and its first bucket.
+func (c *Cuckoo) locate(data []byte) (fp, i uint64) {
+	h := murmur3.Sum64WithSeed(data, c.seed)
+	fp = h >> 32 & c.fpMask()
+	if fp == 0 {
+		fp = 1 // 0 marks empty slots
+	}
+	return fp, h & (c.buckets - 1)
+}
+
+// alt returns the other bucket of fingerprint fp in bucket i. It is its
+// own inverse, the two buckets of an item lead to each other.
+func (c *Cuckoo) alt(i, fp uint64) uint64 {
+	buf := [4]byte{byte(fp), byte(fp >> 8), byte(fp >> 16), byte(fp >> 24)}
+	return (i ^ murmur3.Sum64WithSeed(buf[:], c.seed)) & (c.buckets - 1)
+}
+
+// insert puts fp into a free slot of bucket i.
+func (c *Cuckoo) insert(i, fp uint64) bool {
+	for j := 0; j < BucketSize; j++ {
+		if c.slot(i, j) == 0 {
+			c.setSlot(i, j, fp)
+			return true
+		}
+	}
+	return false
+}
+
+// Insert adds data. Once no more room can be made it fails with ErrFull,
+// leaving the filter unchanged.
+func (c *Cuckoo) Insert(data []byte) error {
+	if c.victim.used {
+		return ErrFull
+	}
+	fp, i1 := c.locate(data)
+	i2 := c.alt(i1, fp)
+	if c.insert(i1, fp) || c.insert(i2, fp) {
+		c.count++
+		return nil
+	}
+
+	// Kick fingerprints on to their other bucket until one finds room.
+	i := i1
+	if c.rnd.Intn(2) == 1 {
+		i = i2
+	}
+	for k := 0; k < MaxKicks; k++ {
+		j := c.rnd.Intn(BucketSize)
+		kicked := c.slot(i, j)
+		c.setSlot(i, j, fp)
+		fp, i = kicked, c.alt(i, kicked)
+		if c.insert(i, fp) {
+			c.count++
+			return nil
+		}
+	}
+	// data is in, but another fingerprint is out of place. Keep it aside
+	// and refuse further items.
+	c.victim.used, c.victim.index, c.victim.fp = true, i, fp
+	c.count++
+	return nil
+}
+
+// Put adds data, see Insert. It drops data when the filter is full, use
+// Insert where that matters.
+func (c *Cuckoo) Put(data []byte) { c.Insert(data) }
+
+// has reports whether bucket i holds fp.
+func (c *Cuckoo) has(i, fp uint64) bool {
+	for j := 0; j < BucketSize; j++ {
+		if c.slot(i, j) == fp {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cuckoo) Contains(data []byte) bool {
+	fp, i1 := c.locate(data)
+	i2 := c.alt(i1, fp)
+	if c.victim.used && c.victim.fp == fp && (c.victim.index == i1 || c.victim.index == i2) {
+		return true
+	}
+	return c.has(i1, fp) || c.has(i2, fp)
+}
+
+// Delete removes one copy of data, which must have been inserted before.
+// Deleting an item that was never inserted may delete another one.
+func (c *Cuckoo) Delete(data []byte) {
+	fp, i1 := c.locate(data)
+	i2 := c.alt(i1, fp)
+	if c.victim.used && c.victim.fp == fp && (c.victim.index == i1 || c.victim.index == i2) {
+		c.victim.used = false
+		c.count--
+		return
+	}
+	for _, i := range []uint64{i1, i2} {
+		for j := 0; j < BucketSize; j++ {
+			if c.slot(i, j) == fp {
+				c.setSlot(i, j, 0)
+				c.count--
+				c.rehome()
+				return
+			}
+		}
+	}
+}
+
+// rehome moves a victim kept aside into the room just freed, if it can.
+func (c *Cuckoo) rehome() {
+	if !c.victim.used {
+		return
+	}
+	v := c.victim
+	if c.insert(v.index, v.fp) || c.insert(c.alt(v.index, v.fp), v.fp) {
+		c.victim.used = false
+	}
+}
+
+// Count returns the number of items in c.
+func (c *Cuckoo) Count() uint64 { return c.count }
+
+// Capacity returns the number of fingerprint slots.
+func (c *Cuckoo) Capacity() uint64 { return c.buckets * BucketSize }
+
+// LoadFactor returns the share of the slots taken.
+func (c *Cuckoo) LoadFactor() float64 { return float64(c.count) / float64(c.Capacity()) }
+
+// FingerprintBits returns the width of the fingerprints.
+func (c *Cuckoo) FingerprintBits() uint { return c.width }
+
+// FPRate returns the expected false positive rate at the current load.
+func (c *Cuckoo) FPRate() float64 {
+	return 1 - math.Pow(1-1/float64(c.fpMask()), 2*BucketSize*c.LoadFactor())
+}
@@ -0,0 +1,89 @@
+package filter
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCuckoo(t *testing.T) {
+	const n = 10000
+	c, err := NewCuckoo(n, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FingerprintBits() != 16 {
+		t.Fatalf("FingerprintBits() = %d for a rate of 0.1%%, want 16", c.FingerprintBits())
+	}
+	for i := 0; i < n; i++ {
+		if err := c.Insert([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Insert(%d) = %v", i, err)
+		}
+	}
+	if c.Count() != n || c.LoadFactor() <= 0.5 {
+		t.Fatalf("Count() = %d, LoadFactor() = %.2f", c.Count(), c.LoadFactor())
+	}
+	for i := 0; i < n; i++ {
+		if !c.Contains([]byte(strconv.Itoa(i))) {
+			t.Fatalf("item %d missing", i)
+		}
+	}
+
+	fp := 0
+	for i := n; i < 11*n; i++ {
+		if c.Contains([]byte(strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / (10 * n); rate > 0.001 {
+		t.Fatalf("false positive rate %.5f, want at most 0.001", rate)
+	}
+
+	for i := 0; i < n; i += 2 {
+		c.Delete([]byte(strconv.Itoa(i)))
+	}
+	for i := 1; i < n; i += 2 {
+		if !c.Contains([]byte(strconv.Itoa(i))) {
+			t.Fatalf("item %d missing after deleting others", i)
+		}
+	}
+	if c.Count() != n/2 {
+		t.Fatalf("Count() = %d, want %d", c.Count(), n/2)
+	}
+}
+
+func TestCuckooFull(t *testing.T) {
+	c, err := NewCuckooWithParams(16, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inserted []string
+	for i := 0; ; i++ {
+		key := strconv.Itoa(i)
+		if err := c.Insert([]byte(key)); err == ErrFull {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		inserted = append(inserted, key)
+		if i > 1000 {
+			t.Fatal("a filter of 64 slots never got full")
+		}
+	}
+	// Nothing inserted is lost to the kicks, the victim included.
+	for _, key := range inserted {
+		if !c.Contains([]byte(key)) {
+			t.Fatalf("item %s missing from the full filter", key)
+		}
+	}
+	if c.LoadFactor() < 0.8 {
+		t.Fatalf("full at a load factor of %.2f", c.LoadFactor())
+	}
+
+	// Deleting makes room again.
+	for _, key := range inserted[:len(inserted)/2] {
+		c.Delete([]byte(key))
+	}
+	if err := c.Insert([]byte("more")); err != nil {
+		t.Fatalf("Insert() after Delete() = %v", err)
+	}
+}
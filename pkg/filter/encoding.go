@@ -0,0 +1,655 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"dutil/pkg/murmur3"
+)
+
+// A filter is encoded as one record, a scalable bloom filter as its own
+// record followed by one per sub-filter. A record is
+//
+//	header   64 bytes, see header.put
+//	payload  the filter words, little endian
+//	checksum murmur3 64 bit hash of header and payload, little endian
+//
+// Everything is a multiple of 8 bytes long, so the payload of a record at
+// an aligned offset can be used in place, see Open.
+
+var (
+	ErrInvalidFilter = errors.New("invalid filter encoding")
+	ErrChecksum      = errors.New("filter checksum mismatch")
+	ErrFilterKind    = errors.New("encoding is of another kind of filter")
+)
+
+var fileMagic = [4]byte{'d', 'f', 'l', 't'}
+
+const (
+	fileVersion = 1
+	headerSize  = 64
+)
+
+// Kinds of filters.
+const (
+	kindBloom = 1 + iota
+	kindCounting
+	kindScalable
+	kindCuckoo
+	kindBloom64
+)
+
+// Hash algorithms of filters.
+const (
+	// murmur3 128 bit with the filter seed, k indices by double hashing.
+	hashMurmur3x128 = 1 + iota
+	// murmur3 64 bit, once per seed.
+	hashMurmur3x64
+)
+
+// header describes the filter of a record. The fields mean what the kind
+// of filter makes of them.
+type header struct {
+	kind, hash, flags uint8
+	m                 uint64 // bits, counters or buckets
+	k                 uint32 // indices per item
+	width             uint32 // bits per bit, counter or fingerprint
+	seed              uint32
+	count             uint64
+	extra, extra2     uint64
+	words             uint64 // payload length
+}
+
+// put writes h to buf[:headerSize].
+func (h *header) put(buf []byte) {
+	le := binary.LittleEndian
+	copy(buf, fileMagic[:])
+	buf[4], buf[5], buf[6], buf[7] = fileVersion, h.kind, h.hash, h.flags
+	le.PutUint64(buf[8:], h.m)
+	le.PutUint32(buf[16:], h.k)
+	le.PutUint32(buf[20:], h.width)
+	le.PutUint32(buf[24:], h.seed)
+	le.PutUint32(buf[28:], 0)
+	le.PutUint64(buf[32:], h.count)
+	le.PutUint64(buf[40:], h.extra)
+	le.PutUint64(buf[48:], h.extra2)
+	le.PutUint64(buf[56:], h.words)
+}
+
+// parseHeader reads the header at the start of data.
+func parseHeader(data []byte) (header, error) {
+	if len(data) < headerSize || !bytes.Equal(data[:4], fileMagic[:]) || data[4] != fileVersion {
+		return header{}, ErrInvalidFilter
+	}
+	le := binary.LittleEndian
+	return header{
+		kind:   data[5],
+		hash:   data[6],
+		flags:  data[7],
+		m:      le.Uint64(data[8:]),
+		k:      le.Uint32(data[16:]),
+		width:  le.Uint32(data[20:]),
+		seed:   le.Uint32(data[24:]),
+		count:  le.Uint64(data[32:]),
+		extra:  le.Uint64(data[40:]),
+		extra2: le.Uint64(data[48:]),
+		words:  le.Uint64(data[56:]),
+	}, nil
+}
+
+// appendRecord appends the record of h and words to buf.
+func appendRecord(buf []byte, h header, words []uint64) []byte {
+	h.words = uint64(len(words))
+	start := len(buf)
+	buf = append(buf, make([]byte, headerSize+8*len(words)+8)...)
+	rec := buf[start:]
+	h.put(rec)
+	for i, w := range words {
+		binary.LittleEndian.PutUint64(rec[headerSize+8*i:], w)
+	}
+	end := len(rec) - 8
+	binary.LittleEndian.PutUint64(rec[end:], murmur3.Sum64(rec[:end]))
+	return buf
+}
+
+// readRecord verifies the record at the start of data and returns its
+// header, its payload and the data after it.
+func readRecord(data []byte) (h header, payload, rest []byte, err error) {
+	if h, err = parseHeader(data); err != nil {
+		return h, nil, nil, err
+	}
+	if len(data) < headerSize+8 || h.words > uint64(len(data)-headerSize-8)/8 {
+		return h, nil, nil, ErrInvalidFilter
+	}
+	end := headerSize + 8*int(h.words)
+	if murmur3.Sum64(data[:end]) != binary.LittleEndian.Uint64(data[end:]) {
+		return h, nil, nil, ErrChecksum
+	}
+	return h, data[headerSize:end], data[end+8:], nil
+}
+
+// record is a header and the words of its payload.
+type record struct {
+	h     header
+	words []uint64
+}
+
+// recorder is implemented by every filter of this package, records returns
+// the records encoding it in order. The words are those of the filter, not
+// copies.
+type recorder interface {
+	records() []record
+}
+
+// marshal returns the encoding of f.
+func marshal(f recorder) []byte {
+	var buf []byte
+	for _, rec := range f.records() {
+		buf = appendRecord(buf, rec.h, rec.words)
+	}
+	return buf
+}
+
+// chunkSize is the length of the chunks records are written and read in, a
+// multiple of 8 holding a header.
+const chunkSize = 4096
+
+// writeTo writes the encoding of f to w one chunk at a time, hashing the
+// chunks as they go, so that no copy of the filter is made.
+func writeTo(w io.Writer, f recorder) (int64, error) {
+	buf := make([]byte, chunkSize)
+	var n int64
+	for _, rec := range f.records() {
+		m, err := writeRecord(w, buf, rec.h, rec.words)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// writeRecord writes the record of h and words to w, encoding it into buf.
+func writeRecord(w io.Writer, buf []byte, h header, words []uint64) (int64, error) {
+	h.words = uint64(len(words))
+	h.put(buf)
+	sum := murmur3.New64()
+	chunk := buf[:headerSize]
+	var n int64
+	for {
+		sum.Write(chunk)
+		m, err := w.Write(chunk)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+		if len(words) == 0 {
+			break
+		}
+		k := len(buf) / 8
+		if k > len(words) {
+			k = len(words)
+		}
+		for i, word := range words[:k] {
+			binary.LittleEndian.PutUint64(buf[8*i:], word)
+		}
+		chunk, words = buf[:8*k], words[k:]
+	}
+	binary.LittleEndian.PutUint64(buf, sum.Sum64())
+	m, err := w.Write(buf[:8])
+	return n + int64(m), err
+}
+
+// recordReader yields the records of an encoded filter one after the other.
+type recordReader interface {
+	next() (header, []uint64, error)
+}
+
+// byteRecords reads the records of an encoding in memory, taking the words
+// from the payloads by words.
+type byteRecords struct {
+	data  []byte
+	words func(payload []byte) []uint64
+}
+
+func (b *byteRecords) next() (header, []uint64, error) {
+	h, payload, rest, err := readRecord(b.data)
+	if err != nil {
+		return h, nil, err
+	}
+	b.data = rest
+	return h, b.words(payload), nil
+}
+
+// wordsAhead is the number of words allocated for a payload before they
+// arrived, a header alone cannot claim gigabytes.
+const wordsAhead = 1 << 16
+
+// streamRecords reads records from r, decoding the payloads straight into
+// their words and verifying the checksums as they go. The first record has
+// to be of kind unless it is zero.
+type streamRecords struct {
+	r    io.Reader
+	kind uint8
+	n    int64 // bytes read
+	buf  []byte
+}
+
+// read fills p from r, running out of data after the first byte is an
+// io.ErrUnexpectedEOF.
+func (s *streamRecords) read(p []byte) error {
+	m, err := io.ReadFull(s.r, p)
+	s.n += int64(m)
+	if err == io.EOF && s.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (s *streamRecords) next() (header, []uint64, error) {
+	if s.buf == nil {
+		s.buf = make([]byte, chunkSize)
+	}
+	if err := s.read(s.buf[:headerSize]); err != nil {
+		return header{}, nil, err
+	}
+	h, err := parseHeader(s.buf)
+	if err != nil {
+		return h, nil, err
+	}
+	if s.kind != 0 && h.kind != s.kind {
+		return h, nil, ErrFilterKind
+	}
+	s.kind = 0
+	if h.words > (math.MaxInt64-headerSize-8)/8 {
+		return h, nil, ErrInvalidFilter
+	}
+	sum := murmur3.New64()
+	sum.Write(s.buf[:headerSize])
+
+	// The words double as they come up to what the header claims.
+	words := make([]uint64, 0, minWords(h.words, wordsAhead))
+	for left := h.words; left > 0; {
+		k := minWords(left, uint64(len(s.buf)/8))
+		chunk := s.buf[:8*k]
+		if err := s.read(chunk); err != nil {
+			return h, nil, err
+		}
+		sum.Write(chunk)
+		if len(words)+int(k) > cap(words) {
+			grown := make([]uint64, len(words), minWords(h.words, 2*uint64(cap(words))))
+			copy(grown, words)
+			words = grown
+		}
+		for i := 0; i < int(k); i++ {
+			words = append(words, binary.LittleEndian.Uint64(chunk[8*i:]))
+		}
+		left -= k
+	}
+
+	if err := s.read(s.buf[:8]); err != nil {
+		return h, nil, err
+	}
+	if sum.Sum64() != binary.LittleEndian.Uint64(s.buf) {
+		return h, nil, ErrChecksum
+	}
+	return h, words, nil
+}
+
+func minWords(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// wordsFor returns the number of words holding n values perWord of which
+// fit in one, without overflowing for any n.
+func wordsFor(n, perWord uint64) uint64 {
+	w := n / perWord
+	if n%perWord != 0 {
+		w++
+	}
+	return w
+}
+
+// copyWords decodes a payload into new words.
+func copyWords(payload []byte) []uint64 {
+	words := make([]uint64, len(payload)/8)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(payload[8*i:])
+	}
+	return words
+}
+
+// decode decodes the filter whose records rr yields.
+func decode(rr recordReader) (BloomFilter, error) {
+	h, w, err := rr.next()
+	if err != nil {
+		return nil, err
+	}
+
+	// The sizes are checked by wordsFor, so that no m can claim more bits,
+	// counters or buckets than the words hold.
+	switch h.kind {
+	case kindBloom:
+		if h.hash != hashMurmur3x128 || h.m == 0 || h.k == 0 || uint64(len(w)) != wordsFor(h.m, 64) {
+			return nil, ErrInvalidFilter
+		}
+		return &Bloom{m: h.m, k: h.k, seed: h.seed, count: h.count, bits: w}, nil
+
+	case kindCounting:
+		c, err := NewCountingBloomWithParams(1, 1, uint(h.width), 0)
+		if err != nil || h.hash != hashMurmur3x128 || h.m == 0 || h.k == 0 || h.width == 0 {
+			return nil, ErrInvalidFilter
+		}
+		if uint64(len(w)) != wordsFor(h.m, 64/uint64(h.width)) {
+			return nil, ErrInvalidFilter
+		}
+		c.m, c.k, c.seed, c.count, c.overflows, c.words = h.m, h.k, h.seed, h.count, h.extra, w
+		return c, nil
+
+	case kindCuckoo:
+		c, err := NewCuckooWithParams(1, uint(h.width), h.seed)
+		if err != nil || h.hash != hashMurmur3x64 || h.m == 0 || h.m&(h.m-1) != 0 || h.m > math.MaxUint64/BucketSize {
+			return nil, ErrInvalidFilter
+		}
+		if uint64(len(w)) != wordsFor(h.m*BucketSize, 64/uint64(h.width)) || h.flags&1 != 0 && h.extra >= h.m {
+			return nil, ErrInvalidFilter
+		}
+		c.buckets, c.count, c.slots = h.m, h.count, w
+		c.victim.used, c.victim.index, c.victim.fp = h.flags&1 != 0, h.extra, h.extra2
+		return c, nil
+
+	case kindScalable:
+		if len(w) != 3 || h.m == 0 {
+			return nil, ErrInvalidFilter
+		}
+		s, err := NewScalableBloomWithParams(h.m, math.Float64frombits(w[0]),
+			math.Float64frombits(w[1]), math.Float64frombits(w[2]))
+		if err != nil {
+			return nil, ErrInvalidFilter
+		}
+		s.filters, s.capacity = nil, nil
+		for i := uint32(0); i < h.k; i++ {
+			f, err := decode(rr)
+			if err != nil {
+				return nil, err
+			}
+			b, ok := f.(*Bloom)
+			if !ok {
+				return nil, ErrInvalidFilter
+			}
+			capacity, _ := s.params(len(s.filters))
+			s.filters, s.capacity = append(s.filters, b), append(s.capacity, capacity)
+		}
+		if len(s.filters) == 0 {
+			return nil, ErrInvalidFilter
+		}
+		return s, nil
+
+	case kindBloom64:
+		seeds := int(h.k)
+		if h.hash != hashMurmur3x64 || h.m != BitSize || len(w) != (seeds+1)/2+BitSize/64 {
+			return nil, ErrInvalidFilter
+		}
+		b := NewBloomFilter64(make([]uint32, seeds))
+		for i := range b.Seeds {
+			b.Seeds[i] = uint32(w[i/2] >> (32 * uint(i%2)))
+		}
+		for i, word := range w[(seeds+1)/2:] {
+			for j := 0; j < 64; j++ {
+				b.BitArr[64*i+j] = byte(word >> uint(j) & 1)
+			}
+		}
+		return b, nil
+	}
+	return nil, ErrInvalidFilter
+}
+
+// Unmarshal decodes a filter encoded by the MarshalBinary method of any
+// filter of this package.
+func Unmarshal(data []byte) (BloomFilter, error) {
+	rr := &byteRecords{data: data, words: copyWords}
+	f, err := decode(rr)
+	if err != nil {
+		return nil, err
+	}
+	if len(rr.data) != 0 {
+		return nil, ErrInvalidFilter
+	}
+	return f, nil
+}
+
+// unmarshalKind decodes data, which must encode a filter of kind.
+func unmarshalKind(data []byte, kind uint8) (BloomFilter, error) {
+	h, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if h.kind != kind {
+		return nil, ErrFilterKind
+	}
+	return Unmarshal(data)
+}
+
+// ReadFilter reads a filter written by the WriteTo method of any filter of
+// this package.
+func ReadFilter(r io.Reader) (BloomFilter, error) {
+	return decode(&streamRecords{r: r})
+}
+
+// readFrom reads a filter of kind from r.
+func readFrom(r io.Reader, kind uint8) (BloomFilter, int64, error) {
+	rr := &streamRecords{r: r, kind: kind}
+	f, err := decode(rr)
+	return f, rr.n, err
+}
+
+func (b *Bloom) records() []record {
+	return []record{{header{
+		kind:  kindBloom,
+		hash:  hashMurmur3x128,
+		m:     b.m,
+		k:     b.k,
+		width: 1,
+		seed:  b.seed,
+		count: b.count,
+	}, b.bits}}
+}
+
+// MarshalBinary encodes b with its parameters, seed and hash algorithm.
+func (b *Bloom) MarshalBinary() ([]byte, error) { return marshal(b), nil }
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary into b.
+func (b *Bloom) UnmarshalBinary(data []byte) error {
+	f, err := unmarshalKind(data, kindBloom)
+	if err != nil {
+		return err
+	}
+	*b = *f.(*Bloom)
+	return nil
+}
+
+// WriteTo writes the encoding of b to w.
+func (b *Bloom) WriteTo(w io.Writer) (int64, error) { return writeTo(w, b) }
+
+// ReadFrom reads a filter written by WriteTo from r into b.
+func (b *Bloom) ReadFrom(r io.Reader) (int64, error) {
+	f, n, err := readFrom(r, kindBloom)
+	if err == nil {
+		*b = *f.(*Bloom)
+	}
+	return n, err
+}
+
+func (c *CountingBloom) records() []record {
+	return []record{{header{
+		kind:  kindCounting,
+		hash:  hashMurmur3x128,
+		m:     c.m,
+		k:     c.k,
+		width: uint32(c.width),
+		seed:  c.seed,
+		count: c.count,
+		extra: c.overflows,
+	}, c.words}}
+}
+
+// MarshalBinary encodes c with its parameters, seed and hash algorithm.
+func (c *CountingBloom) MarshalBinary() ([]byte, error) { return marshal(c), nil }
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary into c.
+func (c *CountingBloom) UnmarshalBinary(data []byte) error {
+	f, err := unmarshalKind(data, kindCounting)
+	if err != nil {
+		return err
+	}
+	*c = *f.(*CountingBloom)
+	return nil
+}
+
+// WriteTo writes the encoding of c to w.
+func (c *CountingBloom) WriteTo(w io.Writer) (int64, error) { return writeTo(w, c) }
+
+// ReadFrom reads a filter written by WriteTo from r into c.
+func (c *CountingBloom) ReadFrom(r io.Reader) (int64, error) {
+	f, n, err := readFrom(r, kindCounting)
+	if err == nil {
+		*c = *f.(*CountingBloom)
+	}
+	return n, err
+}
+
+func (s *ScalableBloom) records() []record {
+	recs := []record{{header{
+		kind:  kindScalable,
+		hash:  hashMurmur3x128,
+		m:     s.n,
+		k:     uint32(len(s.filters)),
+		count: s.Count(),
+	}, []uint64{
+		math.Float64bits(s.fp),
+		math.Float64bits(s.growth),
+		math.Float64bits(s.tightening),
+	}}}
+	for _, f := range s.filters {
+		recs = append(recs, f.records()...)
+	}
+	return recs
+}
+
+// MarshalBinary encodes s with its parameters, followed by its sub-filters.
+func (s *ScalableBloom) MarshalBinary() ([]byte, error) { return marshal(s), nil }
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary into s.
+func (s *ScalableBloom) UnmarshalBinary(data []byte) error {
+	f, err := unmarshalKind(data, kindScalable)
+	if err != nil {
+		return err
+	}
+	*s = *f.(*ScalableBloom)
+	return nil
+}
+
+// WriteTo writes the encoding of s to w.
+func (s *ScalableBloom) WriteTo(w io.Writer) (int64, error) { return writeTo(w, s) }
+
+// ReadFrom reads a filter written by WriteTo from r into s.
+func (s *ScalableBloom) ReadFrom(r io.Reader) (int64, error) {
+	f, n, err := readFrom(r, kindScalable)
+	if err == nil {
+		*s = *f.(*ScalableBloom)
+	}
+	return n, err
+}
+
+func (c *Cuckoo) records() []record {
+	h := header{
+		kind:  kindCuckoo,
+		hash:  hashMurmur3x64,
+		m:     c.buckets,
+		k:     2,
+		width: uint32(c.width),
+		seed:  c.seed,
+		count: c.count,
+	}
+	if c.victim.used {
+		h.flags, h.extra, h.extra2 = 1, c.victim.index, c.victim.fp
+	}
+	return []record{{h, c.slots}}
+}
+
+// MarshalBinary encodes c with its parameters, seed and hash algorithm.
+func (c *Cuckoo) MarshalBinary() ([]byte, error) { return marshal(c), nil }
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary into c.
+func (c *Cuckoo) UnmarshalBinary(data []byte) error {
+	f, err := unmarshalKind(data, kindCuckoo)
+	if err != nil {
+		return err
+	}
+	*c = *f.(*Cuckoo)
+	return nil
+}
+
+// WriteTo writes the encoding of c to w.
+func (c *Cuckoo) WriteTo(w io.Writer) (int64, error) { return writeTo(w, c) }
+
+// ReadFrom reads a filter written by WriteTo from r into c.
+func (c *Cuckoo) ReadFrom(r io.Reader) (int64, error) {
+	f, n, err := readFrom(r, kindCuckoo)
+	if err == nil {
+		*c = *f.(*Cuckoo)
+	}
+	return n, err
+}
+
+// records packs the bits of b, the only filter whose words are a copy.
+func (b *bloomFilter64) records() []record {
+	words := make([]uint64, (len(b.Seeds)+1)/2+BitSize/64)
+	for i, s := range b.Seeds {
+		words[i/2] |= uint64(s) << (32 * uint(i%2))
+	}
+	bits := words[(len(b.Seeds)+1)/2:]
+	for i, v := range b.BitArr {
+		if v != 0 {
+			bits[i/64] |= 1 << uint(i%64)
+		}
+	}
+	return []record{{header{
+		kind:  kindBloom64,
+		hash:  hashMurmur3x64,
+		m:     BitSize,
+		k:     uint32(len(b.Seeds)),
+		width: 8,
+	}, words}}
+}
+
+// MarshalBinary encodes b with its seeds, its bits packed.
+func (b *bloomFilter64) MarshalBinary() ([]byte, error) { return marshal(b), nil }
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary into b.
+func (b *bloomFilter64) UnmarshalBinary(data []byte) error {
+	f, err := unmarshalKind(data, kindBloom64)
+	if err != nil {
+		return err
+	}
+	*b = *f.(*bloomFilter64)
+	return nil
+}
+
+// WriteTo writes the encoding of b to w.
+func (b *bloomFilter64) WriteTo(w io.Writer) (int64, error) { return writeTo(w, b) }
+
+// ReadFrom reads a filter written by WriteTo from r into b.
+func (b *bloomFilter64) ReadFrom(r io.Reader) (int64, error) {
+	f, n, err := readFrom(r, kindBloom64)
+	if err == nil {
+		*b = *f.(*bloomFilter64)
+	}
+	return n, err
+}
@@ -0,0 +1,262 @@
+package filter
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// serializable is what every filter of the package implements.
+type serializable interface {
+	BloomFilter
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// testFilters returns one filter of each kind holding items 0 to n-1, and
+// an empty one of the same kind to decode into.
+func testFilters(t *testing.T, n int) map[string][2]serializable {
+	t.Helper()
+	b, err := NewBloom(uint64(n), 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCountingBloom(uint64(n), 0.01, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewScalableBloom(uint64(n/10), 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ck, err := NewCuckoo(uint64(n), 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := map[string][2]serializable{
+		"bloom":    {b, &Bloom{}},
+		"counting": {c, &CountingBloom{}},
+		"scalable": {s, &ScalableBloom{}},
+		"cuckoo":   {ck, &Cuckoo{}},
+		"bloom64":  {NewBloomFilter64([]uint32{1, 2, 3}), NewBloomFilter64(nil)},
+	}
+	for _, f := range filters {
+		for i := 0; i < n; i++ {
+			f[0].Put([]byte(strconv.Itoa(i)))
+		}
+	}
+	return filters
+}
+
+// sameItems checks that got answers like want, for the items and others.
+func sameItems(t *testing.T, name string, got, want interface{ Contains([]byte) bool }, n int) {
+	t.Helper()
+	for i := 0; i < 2*n; i++ {
+		item := []byte(strconv.Itoa(i))
+		if got.Contains(item) != want.Contains(item) {
+			t.Fatalf("%s: Contains(%d) = %v, want %v", name, i, got.Contains(item), want.Contains(item))
+		}
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	const n = 1000
+	for name, f := range testFilters(t, n) {
+		data, err := f[0].MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: MarshalBinary() = %v", name, err)
+		}
+		if err := f[1].UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: UnmarshalBinary() = %v", name, err)
+		}
+		sameItems(t, name, f[1], f[0], n)
+
+		g, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: Unmarshal() = %v", name, err)
+		}
+		if reflect.TypeOf(g) != reflect.TypeOf(f[0]) {
+			t.Fatalf("%s: Unmarshal() = %T, want %T", name, g, f[0])
+		}
+		sameItems(t, name, g, f[0], n)
+
+		// The decoded filter is a working copy.
+		f[1].Put([]byte("new"))
+		if !f[1].Contains([]byte("new")) {
+			t.Fatalf("%s: item put after decoding missing", name)
+		}
+	}
+}
+
+func TestMarshalBinaryCounts(t *testing.T) {
+	s, _ := NewScalableBloom(10, 0.01)
+	for i := 0; i < 100; i++ {
+		s.Put([]byte(strconv.Itoa(i)))
+	}
+	data, _ := s.MarshalBinary()
+	var got ScalableBloom
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got.Count() != s.Count() || got.Filters() != s.Filters() || !reflect.DeepEqual(got.capacity, s.capacity) {
+		t.Fatalf("Count(), Filters() = %d, %d, want %d, %d", got.Count(), got.Filters(), s.Count(), s.Filters())
+	}
+	// It keeps growing where it left off.
+	for i := 100; i < 200; i++ {
+		got.Put([]byte(strconv.Itoa(i)))
+	}
+	if got.Filters() <= s.Filters() {
+		t.Fatalf("Filters() = %d after more items, want more than %d", got.Filters(), s.Filters())
+	}
+
+	c, _ := NewCuckooWithParams(1, 8, 7)
+	for i := 0; c.Insert([]byte(strconv.Itoa(i))) == nil; i++ {
+	}
+	data, _ = c.MarshalBinary()
+	var gotc Cuckoo
+	if err := gotc.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if gotc.Count() != c.Count() || gotc.victim != c.victim || !gotc.victim.used {
+		t.Fatalf("Count() = %d, victim = %+v, want %d, %+v", gotc.Count(), gotc.victim, c.Count(), c.victim)
+	}
+}
+
+func TestUnmarshalBinaryErrors(t *testing.T) {
+	b, _ := NewBloom(100, 0.01)
+	b.Put([]byte("a"))
+	data, _ := b.MarshalBinary()
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[headerSize] ^= 1
+	if _, err := Unmarshal(corrupt); err != ErrChecksum {
+		t.Fatalf("Unmarshal() of a flipped bit = %v, want %v", err, ErrChecksum)
+	}
+	if _, err := Unmarshal(data[:len(data)-1]); err != ErrInvalidFilter {
+		t.Fatalf("Unmarshal() of a short encoding = %v, want %v", err, ErrInvalidFilter)
+	}
+	if _, err := Unmarshal(data[:10]); err != ErrInvalidFilter {
+		t.Fatalf("Unmarshal() of a short header = %v, want %v", err, ErrInvalidFilter)
+	}
+	if _, err := Unmarshal(append(data, 0)); err != ErrInvalidFilter {
+		t.Fatalf("Unmarshal() with trailing data = %v, want %v", err, ErrInvalidFilter)
+	}
+	version := append([]byte(nil), data...)
+	version[4] = fileVersion + 1
+	if _, err := Unmarshal(version); err != ErrInvalidFilter {
+		t.Fatalf("Unmarshal() of a newer version = %v, want %v", err, ErrInvalidFilter)
+	}
+	var c Cuckoo
+	if err := c.UnmarshalBinary(data); err != ErrFilterKind {
+		t.Fatalf("Cuckoo.UnmarshalBinary() of a Bloom = %v, want %v", err, ErrFilterKind)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	const n = 1000
+	for name, f := range testFilters(t, n) {
+		var buf bytes.Buffer
+		written, err := f[0].WriteTo(&buf)
+		if err != nil || written != int64(buf.Len()) {
+			t.Fatalf("%s: WriteTo() = %d, %v, want %d", name, written, err, buf.Len())
+		}
+		// Another filter follows, ReadFrom must stop at its own end.
+		buf.WriteString("next")
+		read, err := f[1].ReadFrom(&buf)
+		if err != nil || read != written {
+			t.Fatalf("%s: ReadFrom() = %d, %v, want %d", name, read, err, written)
+		}
+		if buf.String() != "next" {
+			t.Fatalf("%s: ReadFrom() left %q, want %q", name, buf.String(), "next")
+		}
+		sameItems(t, name, f[1], f[0], n)
+
+		buf.Reset()
+		f[0].WriteTo(&buf)
+		g, err := ReadFilter(&buf)
+		if err != nil {
+			t.Fatalf("%s: ReadFilter() = %v", name, err)
+		}
+		sameItems(t, name, g, f[0], n)
+	}
+}
+
+func TestUnmarshalOversized(t *testing.T) {
+	// A checksum does not keep m from claiming more than the words hold.
+	for _, h := range []header{
+		{kind: kindBloom, hash: hashMurmur3x128, m: math.MaxUint64, k: 1, width: 1},
+		{kind: kindCounting, hash: hashMurmur3x128, m: math.MaxUint64, k: 1, width: 4},
+		{kind: kindCuckoo, hash: hashMurmur3x64, m: 1 << 63, k: 2, width: 8},
+	} {
+		if f, err := Unmarshal(appendRecord(nil, h, nil)); err != ErrInvalidFilter {
+			t.Fatalf("Unmarshal() of kind %d with m = %d = %v, %v, want %v", h.kind, h.m, f, err, ErrInvalidFilter)
+		}
+		if f, err := Unmarshal(appendRecord(nil, h, []uint64{0})); err != ErrInvalidFilter {
+			t.Fatalf("Unmarshal() of kind %d with m = %d = %v, %v, want %v", h.kind, h.m, f, err, ErrInvalidFilter)
+		}
+	}
+
+	// Nor does a header make ReadFilter allocate what it claims.
+	data := appendRecord(nil, header{kind: kindBloom, hash: hashMurmur3x128, m: 64, k: 1}, []uint64{0})
+	binary.LittleEndian.PutUint64(data[56:], 1<<40)
+	if _, err := ReadFilter(bytes.NewReader(data)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("ReadFilter() of a truncated record = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// chunkWriter records the longest single write.
+type chunkWriter struct {
+	bytes.Buffer
+	longest int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) > w.longest {
+		w.longest = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestWriteToStreams(t *testing.T) {
+	// More words than allocated ahead, so that reading grows them.
+	b := NewBloomWithParams(64*(wordsAhead+wordsAhead/2), 3, 0)
+	for i := 0; i < 1000; i++ {
+		b.Put([]byte(strconv.Itoa(i)))
+	}
+	var w chunkWriter
+	if _, err := b.WriteTo(&w); err != nil {
+		t.Fatal(err)
+	}
+	if w.longest > chunkSize {
+		t.Fatalf("WriteTo() wrote %d bytes at once, want at most %d", w.longest, chunkSize)
+	}
+	data, _ := b.MarshalBinary()
+	if !bytes.Equal(w.Bytes(), data) {
+		t.Fatal("WriteTo() and MarshalBinary() encode differently")
+	}
+
+	var got Bloom
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.bits, b.bits) || cap(got.bits) != len(b.bits) {
+		t.Fatalf("ReadFrom() read %d words into a capacity of %d, want %d", len(got.bits), cap(got.bits), len(b.bits))
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-9] ^= 1
+	if _, err := got.ReadFrom(bytes.NewReader(corrupt)); err != ErrChecksum {
+		t.Fatalf("ReadFrom() of a flipped bit = %v, want %v", err, ErrChecksum)
+	}
+	var c Cuckoo
+	if _, err := c.ReadFrom(bytes.NewReader(data)); err != ErrFilterKind {
+		t.Fatalf("Cuckoo.ReadFrom() of a Bloom = %v, want %v", err, ErrFilterKind)
+	}
+}
@@ -0,0 +1,64 @@
+package filter
+
+import (
+	"encoding/binary"
+	"reflect"
+	"unsafe"
+)
+
+// Mapped is a read-only filter loaded by Open. On platforms with mmap its
+// words stay in the mapped file rather than on the heap. Open still reads
+// the whole file once to verify its checksum, after that the kernel is free
+// to drop the pages and read back only those that queries touch.
+//
+// A Mapped is safe for concurrent use, but not after Close.
+type Mapped struct {
+	f     BloomFilter
+	unmap func() error
+	data  []byte // the file when read onto the heap, see aliasWords
+}
+
+// Contains reports whether data may have been put into the filter.
+func (m *Mapped) Contains(data []byte) bool { return m.f.Contains(data) }
+
+// Close releases the file of m.
+func (m *Mapped) Close() error {
+	m.f = nil
+	return m.unmap()
+}
+
+// openData decodes the filter in data in place.
+func openData(data []byte, unmap func() error) (*Mapped, error) {
+	rr := &byteRecords{data: data, words: aliasWords}
+	f, err := decode(rr)
+	if err == nil && len(rr.data) != 0 {
+		err = ErrInvalidFilter
+	}
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	return &Mapped{f: f, unmap: unmap}, nil
+}
+
+// nativeLittleEndian reports whether words are stored little endian.
+var nativeLittleEndian = func() bool {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], 1)
+	return *(*uint64)(unsafe.Pointer(&b[0])) == 1
+}()
+
+// aliasWords returns the words of a payload without copying them where
+// the byte order and alignment allow it. The words share memory with
+// payload, which must not be garbage collected before them.
+func aliasWords(payload []byte) []uint64 {
+	if len(payload) == 0 || !nativeLittleEndian || uintptr(unsafe.Pointer(&payload[0]))%8 != 0 {
+		return copyWords(payload)
+	}
+	var words []uint64
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&words))
+	sh.Data = uintptr(unsafe.Pointer(&payload[0]))
+	sh.Len = len(payload) / 8
+	sh.Cap = sh.Len
+	return words
+}
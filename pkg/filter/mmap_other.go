@@ -0,0 +1,22 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package filter
+
+import "io/ioutil"
+
+// Open reads the file at path, written by the WriteTo method of any filter
+// of this package. Without mmap the file is read onto the heap, though its
+// words are not copied again.
+func Open(path string) (*Mapped, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := openData(data, func() error { return nil })
+	if m != nil {
+		// The words point into data without the garbage collector knowing.
+		m.data = data
+	}
+	return m, err
+}
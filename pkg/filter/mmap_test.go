@@ -0,0 +1,65 @@
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const n = 1000
+	for name, f := range testFilters(t, n) {
+		path := filepath.Join(dir, name)
+		data, _ := f[0].MarshalBinary()
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: Open() = %v", name, err)
+		}
+		sameItems(t, name, m, f[0], n)
+		if err := m.Close(); err != nil {
+			t.Fatalf("%s: Close() = %v", name, err)
+		}
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("Open() of a missing file = %v", err)
+	}
+	path := filepath.Join(dir, "garbage")
+	ioutil.WriteFile(path, make([]byte, 100), 0644)
+	if _, err := Open(path); err != ErrInvalidFilter {
+		t.Fatalf("Open() of garbage = %v, want %v", err, ErrInvalidFilter)
+	}
+}
+
+func TestOpenInPlace(t *testing.T) {
+	if !nativeLittleEndian {
+		t.Skip("words are copied on big endian platforms")
+	}
+	b := NewBloomWithParams(1<<16, 3, 0)
+	b.Put([]byte("a"))
+	data, _ := b.MarshalBinary()
+	buf := make([]uint64, len(data)/8)
+	aligned := (*[1 << 20]byte)(unsafe.Pointer(&buf[0]))[:len(data):len(data)]
+	copy(aligned, data)
+
+	f, err := decode(&byteRecords{data: aligned, words: aliasWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The words are the payload, not a copy of it.
+	aligned[headerSize] ^= 0xff
+	if f.(*Bloom).bits[0] != b.bits[0]^0xff {
+		t.Fatalf("words copied, want them in place")
+	}
+}
@@ -0,0 +1,34 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package filter
+
+import (
+	"os"
+	"syscall"
+)
+
+// Open maps the file at path, written by the WriteTo method of any filter
+// of this package, read-only into memory and decodes it in place. The
+// file is read through once to verify its checksum.
+func Open(path string) (*Mapped, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := st.Size()
+	if size < headerSize || size != int64(int(size)) {
+		return nil, ErrInvalidFilter
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	return openData(data, func() error { return syscall.Munmap(data) })
+}
@@ -0,0 +1,143 @@
+package filter
+
+import "errors"
+
+const (
+	// DefaultGrowth is the factor each sub-filter of a ScalableBloom holds
+	// more items than the one before, unless told otherwise.
+	DefaultGrowth = 2
+	// DefaultTightening is the factor the false positive rate of each
+	// sub-filter of a ScalableBloom is lower than the one before, unless
+	// told otherwise.
+	DefaultTightening = 0.85
+)
+
+var ErrInvalidGrowth = errors.New("growth must be at least 1 and tightening within (0, 1)")
+
+// ScalableBloom is a bloom filter growing with its items, as described in
+// "Scalable Bloom Filters" by Almeida et al. It chains sub-filters, a new
+// one is added when the last one is full. Sub-filter i holds n*growth^i
+// items at a false positive rate of fp*(1-tightening)*tightening^i, so the
+// rates add up to at most fp however many sub-filters there are.
+type ScalableBloom struct {
+	n          uint64
+	fp         float64
+	growth     float64
+	tightening float64
+	filters    []*Bloom
+	// Items each sub-filter is sized for.
+	capacity []uint64
+}
+
+var _ BloomFilter = (*ScalableBloom)(nil)
+
+// NewScalableBloom returns a scalable bloom filter starting out with room
+// for n items and keeping an overall false positive rate of fp, with the
+// default growth and tightening.
+func NewScalableBloom(n uint64, fp float64) (*ScalableBloom, error) {
+	return NewScalableBloomWithParams(n, fp, DefaultGrowth, DefaultTightening)
+}
+
+// NewScalableBloomWithParams returns a scalable bloom filter starting out
+// with room for n items and keeping an overall false positive rate of fp,
+// each sub-filter holding growth times the items of the one before at
+// tightening times its false positive rate.
+func NewScalableBloomWithParams(n uint64, fp, growth, tightening float64) (*ScalableBloom, error) {
+	if !(fp > 0 && fp < 1) {
+		return nil, ErrInvalidRate
+	}
+	if !(growth >= 1) || !(tightening > 0 && tightening < 1) {
+		return nil, ErrInvalidGrowth
+	}
+	if n == 0 {
+		n = 1
+	}
+	s := &ScalableBloom{n: n, fp: fp, growth: growth, tightening: tightening}
+	s.grow()
+	return s, nil
+}
+
+// params returns the items sub-filter i is sized for and its false
+// positive rate.
+func (s *ScalableBloom) params(i int) (capacity uint64, fp float64) {
+	c, fp := float64(s.n), s.fp*(1-s.tightening)
+	for j := 0; j < i; j++ {
+		c *= s.growth
+		fp *= s.tightening
+	}
+	return uint64(c), fp
+}
+
+// grow appends the next sub-filter.
+func (s *ScalableBloom) grow() {
+	i := len(s.filters)
+	capacity, fp := s.params(i)
+	m, k := BloomParams(capacity, fp)
+	// Every sub-filter hashes with its own seed, so their false positives
+	// are independent.
+	s.filters = append(s.filters, NewBloomWithParams(m, k, uint32(i)))
+	s.capacity = append(s.capacity, capacity)
+}
+
+// Put adds data unless it is contained already, growing the filter when
+// the last sub-filter is full.
+func (s *ScalableBloom) Put(data []byte) {
+	if s.Contains(data) {
+		return
+	}
+	last := len(s.filters) - 1
+	if s.filters[last].Count() >= s.capacity[last] {
+		s.grow()
+		last++
+	}
+	s.filters[last].Put(data)
+}
+
+func (s *ScalableBloom) Contains(data []byte) bool {
+	// Newer sub-filters hold more items, look there first.
+	for i := len(s.filters) - 1; i >= 0; i-- {
+		if s.filters[i].Contains(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete clears data in every sub-filter containing it, see Bloom.Delete
+// for why that may lose other items.
+func (s *ScalableBloom) Delete(data []byte) {
+	for _, f := range s.filters {
+		f.Delete(data)
+	}
+}
+
+// Count returns the number of items put.
+func (s *ScalableBloom) Count() uint64 {
+	var n uint64
+	for _, f := range s.filters {
+		n += f.Count()
+	}
+	return n
+}
+
+// M returns the number of bits of all sub-filters together.
+func (s *ScalableBloom) M() uint64 {
+	var m uint64
+	for _, f := range s.filters {
+		m += f.M()
+	}
+	return m
+}
+
+// Filters returns the number of sub-filters.
+func (s *ScalableBloom) Filters() int { return len(s.filters) }
+
+// FPRate returns the expected false positive rate for the items put so
+// far, the chance that any sub-filter gives one.
+func (s *ScalableBloom) FPRate() float64 {
+	none := 1.0
+	for _, f := range s.filters {
+		none *= 1 - f.FPRate()
+	}
+	return 1 - none
+}
@@ -0,0 +1,48 @@
+package filter
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestScalableBloom(t *testing.T) {
+	const fp = 0.01
+	s, err := NewScalableBloom(1000, fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 50 times the initial capacity.
+	const n = 50000
+	for i := 0; i < n; i++ {
+		s.Put([]byte(strconv.Itoa(i)))
+	}
+	if s.Filters() < 5 {
+		t.Fatalf("%d sub-filters for 50 times the initial capacity", s.Filters())
+	}
+	if c := s.Count(); c > n || c < n*99/100 {
+		t.Fatalf("Count() = %d, want about %d", c, n)
+	}
+	for i := 0; i < n; i++ {
+		if !s.Contains([]byte(strconv.Itoa(i))) {
+			t.Fatalf("item %d missing", i)
+		}
+	}
+
+	fps := 0
+	for i := n; i < 3*n; i++ {
+		if s.Contains([]byte(strconv.Itoa(i))) {
+			fps++
+		}
+	}
+	if rate := float64(fps) / (2 * n); rate > fp {
+		t.Fatalf("false positive rate %.4f, want at most %v", rate, fp)
+	}
+	if rate := s.FPRate(); rate > fp {
+		t.Fatalf("FPRate() = %.4f, want at most %v", rate, fp)
+	}
+
+	if _, err := NewScalableBloomWithParams(1000, fp, 2, 1); err != ErrInvalidGrowth {
+		t.Fatalf("NewScalableBloomWithParams() with a tightening of 1 = %v, want %v", err, ErrInvalidGrowth)
+	}
+}